@@ -1,27 +1,135 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/gholt/blackfridaytext"
 )
 
 func main() {
-	opt := &blackfridaytext.Options{Color: true}
-	if len(os.Args) == 2 && os.Args[1] == "--no-color" {
-		opt.Color = false
+	noColor := flag.Bool("no-color", false, "disable ANSI color escape codes")
+	colorMode := flag.String("color", "auto", "colors to use: auto, none, 16, 256 or truecolor")
+	theme := flag.String("theme", "", "color theme: "+strings.Join(blackfridaytext.ThemeNames(), ", ")+", or the path of a TOML or JSON theme file")
+	layout := flag.String("metadata", "table", "metadata display: table, header or hidden")
+	commonMark := flag.Bool("commonmark", false, "parse the input as CommonMark rather than with Blackfriday")
+	schema := flag.String("schema", "", "validate the metadata of the files named, or stdin, against this JSON schema instead of rendering")
+	flag.Parse()
+	if *schema != "" {
+		os.Exit(validate(*schema, flag.Args()))
+	}
+	opt := &blackfridaytext.Options{Color: !*noColor}
+	switch *colorMode {
+	case "auto":
+		opt.ColorMode = blackfridaytext.ColorModeAuto
+	case "none":
+		opt.ColorMode = blackfridaytext.ColorModeNone
+	case "16":
+		opt.ColorMode = blackfridaytext.ColorMode16
+	case "256":
+		opt.ColorMode = blackfridaytext.ColorMode256
+	case "truecolor":
+		opt.ColorMode = blackfridaytext.ColorModeTrueColor
+	default:
+		fmt.Fprintf(os.Stderr, "unknown color mode %q\n", *colorMode)
+		os.Exit(2)
+	}
+	if *noColor {
+		opt.ColorMode = blackfridaytext.ColorModeNone
+	}
+	if *theme != "" {
+		styles, err := loadTheme(*theme)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		opt.Styles = styles
+	}
+	if *commonMark {
+		opt.Parser = blackfridaytext.ParserCommonMark
+	}
+	switch *layout {
+	case "table":
+		opt.MetadataLayout = blackfridaytext.MetadataTable
+	case "header":
+		opt.MetadataLayout = blackfridaytext.MetadataHeader
+	case "hidden":
+		opt.MetadataLayout = blackfridaytext.MetadataHidden
+	default:
+		fmt.Fprintf(os.Stderr, "unknown metadata layout %q\n", *layout)
+		os.Exit(2)
 	}
 	markdown, _ := ioutil.ReadAll(os.Stdin)
-	metadata, output := blackfridaytext.MarkdownToText(markdown, opt)
-	for _, item := range metadata {
-		name, value := item[0], item[1]
-		os.Stdout.WriteString(name)
-		os.Stdout.WriteString(":\n    ")
-		os.Stdout.WriteString(value)
+	metadata, output := blackfridaytext.MarkdownToTextMetadata(markdown, opt)
+	if block := blackfridaytext.RenderMetadata(metadata, opt); len(block) > 0 {
+		os.Stdout.Write(block)
 		os.Stdout.WriteString("\n")
 	}
-	os.Stdout.WriteString("\n")
 	os.Stdout.Write(output)
 	os.Stdout.WriteString("\n")
 }
+
+// loadTheme returns the built-in theme of the name or, if there is none,
+// the theme file at the path.
+func loadTheme(nameOrPath string) (blackfridaytext.Theme, error) {
+	if theme := blackfridaytext.NamedTheme(nameOrPath); theme != nil {
+		return theme, nil
+	}
+	data, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, err
+	}
+	theme, err := blackfridaytext.LoadTheme(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", nameOrPath, err)
+	}
+	return theme, nil
+}
+
+// validate prints the metadata problems of each file as "file:line: ..."
+// and returns the exit status: 0 if there were none, 1 if there were, and 2
+// if the schema or a file could not be read.
+func validate(schemaPath string, paths []string) int {
+	data, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	schema, err := blackfridaytext.ParseMetadataSchema(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", schemaPath, err)
+		return 2
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	status := 0
+	for _, path := range paths {
+		var markdown []byte
+		if path == "-" {
+			markdown, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			markdown, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+			continue
+		}
+		diags, err := blackfridaytext.ValidateMetadata(markdown, schema)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", schemaPath, err)
+			return 2
+		}
+		for _, diag := range diags {
+			fmt.Printf("%s:%s\n", path, diag)
+		}
+		if len(diags) > 0 && status == 0 {
+			status = 1
+		}
+	}
+	return status
+}
@@ -1,9 +1,62 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
 func TestRuns(t *testing.T) {
 	main()
 }
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackfridaytext-tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schema := filepath.Join(dir, "schema.json")
+	good := filepath.Join(dir, "good.md")
+	bad := filepath.Join(dir, "bad.md")
+	for path, content := range map[string]string{
+		schema: `{"fields": [{"name": "Title", "required": true}]}`,
+		good:   "Title: T\n\nBody\n",
+		bad:    "Body\n",
+	} {
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if status := validate(schema, []string{good}); status != 0 {
+		t.Errorf("%d != 0", status)
+	}
+	if status := validate(schema, []string{good, bad}); status != 1 {
+		t.Errorf("%d != 1", status)
+	}
+	if status := validate(filepath.Join(dir, "missing.json"), []string{good}); status != 2 {
+		t.Errorf("%d != 2", status)
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	if theme, err := loadTheme("dark"); err != nil || theme == nil {
+		t.Errorf("%#v %#v", theme, err)
+	}
+	dir, err := ioutil.TempDir("", "blackfridaytext-tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "theme.toml")
+	if err := ioutil.WriteFile(path, []byte("base = \"dark\"\n[header]\nbold = true\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if theme, err := loadTheme(path); err != nil || theme == nil {
+		t.Errorf("%#v %#v", theme, err)
+	}
+	if _, err := loadTheme(filepath.Join(dir, "missing.toml")); err == nil {
+		t.Errorf("no error for a missing theme file")
+	}
+}
@@ -7,10 +7,18 @@
 //
 // The Markdown supported is that supported by BlackFriday itself, with its
 // tables, fenced code, autolinking, strikethrough, and definition lists turned
-// on.
+// on by default; see Options.Extensions. Alternatively, CommonMark may be
+// parsed with goldmark https://github.com/yuin/goldmark; see Parser.
 //
-// There is optional support for colorized output, as well as line wrapping and
-// reflowing elements such as tables.
+// There is optional support for colorized output, styled by a Theme and
+// limited to the colors of the terminal with ColorMode, as well as line
+// wrapping and reflowing elements such as tables. MarkdownToDocument and
+// Layout split rendering in two, for changing the Document in between, and
+// how individual elements render may be overridden with a NodeRenderer.
+//
+// Local images may optionally be displayed inline on terminals supporting the
+// kitty, iTerm2, or sixel graphics protocols, or drawn as text art; see
+// ImageProtocol.
 //
 // There is also optional support for Markdown Metadata
 // https://github.com/fletcher/MultiMarkdown/wiki/MultiMarkdown-Syntax-Guide#metadata
@@ -19,11 +27,11 @@ package blackfridaytext
 
 import (
 	"bytes"
-	"fmt"
-	"strings"
+	"os"
+	"strconv"
 
 	"github.com/gholt/brimtext"
-	"github.com/russross/blackfriday"
+	"github.com/russross/blackfriday/v2"
 )
 
 // Options contains the configuration for MarkdownToText and
@@ -36,11 +44,19 @@ type Options struct {
 	Width int
 	// Color set true will allow ANSI Color Escape Codes.
 	Color bool
-	// The following are the byte values for each color output for the
-	// differing elements. Each will be followed by ColorReset. Usually these
-	// are set to whatever ANSI escape sequences you want. Left nil, they will
-	// be set to reasonable defaults. See brimtext.ANSIEscape for some quick
-	// examples to use.
+	// ColorMode indicates which colors may be used, overriding Color unless
+	// left as ColorModeDefault; ColorModeAuto detects them. Colors of
+	// Styles the terminal lacks are replaced with the closest it has.
+	ColorMode ColorMode
+	// Styles are those of the elements with Color set, in place of the
+	// defaults; text within an element is restored to the style of those
+	// enclosing it. A Theme, such as from NamedTheme or LoadTheme, may be
+	// used.
+	Styles map[Element]Style
+	// The following are raw byte values output for each of the differing
+	// elements without a Styles entry, such as ANSI escape sequences, and
+	// ColorReset is what resets them. Left nil, the element has its default
+	// style. See brimtext.ANSIEscape for some quick examples to use.
 	ColorHeader         []byte
 	ColorLink           []byte
 	ColorImage          []byte
@@ -60,6 +76,80 @@ type Options struct {
 	HeaderPrefix []byte
 	// HeaderSuffix is the suffix after any header line.
 	HeaderSuffix []byte
+	// ImageProtocol indicates how images referring to local files are
+	// displayed inline. Left as ImageProtocolNone, the default, images are
+	// shown as "[alt] link" text, which is also the fallback whenever an
+	// image cannot be read or decoded.
+	ImageProtocol ImageProtocol
+	// ImageMaxWidth and ImageMaxHeight limit the size, in character cells,
+	// of ImageProtocolBlocks art; 0 means only the available width limits
+	// it.
+	ImageMaxWidth  int
+	ImageMaxHeight int
+	// ImageTrueColor set true will use 24-bit color escape codes for
+	// ImageProtocolBlocks art rather than the 256 color palette.
+	ImageTrueColor bool
+	// ImageDir is the directory relative image links are resolved against;
+	// empty means the current working directory.
+	ImageDir string
+	// SmartPunctuation set true will replace straight quotes with curly
+	// quotes, "--" and "---" with en and em dashes, "..." with an ellipsis,
+	// and common fractions with their symbols, never within code.
+	SmartPunctuation bool
+	// ASCII set true guarantees 7-bit output for terminals without UTF-8
+	// support: characters, including those from HTML entities such as
+	// "&copy;", are transliterated to ASCII approximations, plain ASCII
+	// table borders are the default, and SmartPunctuation has no effect.
+	ASCII bool
+	// Parser indicates which Markdown parser is used; left as
+	// ParserBlackfriday, the default, Blackfriday is.
+	Parser Parser
+	// Extensions are the Blackfriday extensions to parse with; left 0,
+	// DefaultExtensions are used, so NoExtensions asks for none. Footnotes
+	// are listed at the end of the text, numbered as referenced. For
+	// example, DefaultExtensions&^blackfriday.Autolink disables
+	// autolinking.
+	Extensions blackfriday.Extensions
+	// HTML indicates how HTML embedded in the Markdown is output; see
+	// HTMLPolicy.
+	HTML HTMLPolicy
+	// Renderer, if set, renders the nodes of the parsed Markdown in place
+	// of the default rendering, which it may embed BaseRenderer to keep for
+	// some; see NodeRenderer.
+	Renderer NodeRenderer
+	// SummaryMarkers are the lines that end the summary at the top of the
+	// content; see MarkdownMetadata. Left nil, the marker is "///". Blog
+	// style markers such as "<!--more-->" may be used instead.
+	SummaryMarkers []string
+	// NoSummary set true disables summary detection, leaving any marker
+	// lines in the content as written.
+	NoSummary bool
+	// SummaryText set true will render the "Summary" metadata item as text,
+	// with these same options, rather than returning it as raw Markdown.
+	SummaryText bool
+	// MetadataLayout indicates how RenderMetadata displays metadata; left as
+	// MetadataTable, the default, items are shown as an aligned table.
+	MetadataLayout MetadataLayout
+	// ExpandVariables set true will replace placeholders such as
+	// "{{Version}}" in the content with values from Variables or the
+	// document's metadata before rendering; see the ExpandVariables func.
+	ExpandVariables bool
+	// Variables are values for placeholders, taking precedence over
+	// metadata with the same name.
+	Variables map[string]string
+	// VariableDelimiters are the opening and closing placeholder
+	// delimiters; left empty, "{{" and "}}" are used.
+	VariableDelimiters [2]string
+	// VariableEscape placed before a placeholder leaves it as written;
+	// left empty, "\" is used.
+	VariableEscape string
+	// UnresolvedVariable, if set, is called with the name of each
+	// placeholder in the content that has no value.
+	UnresolvedVariable func(name string)
+	// Getenv is used to look up environment variables when detecting
+	// terminal capabilities, such as with ImageProtocolAuto and
+	// ColorModeAuto. Left nil, os.Getenv is used; mostly useful for testing.
+	Getenv func(string) string
 }
 
 func resolveOpts(opts *Options) *Options {
@@ -73,40 +163,24 @@ func resolveOpts(opts *Options) *Options {
 	if ropts.Width < 10 {
 		ropts.Width = 10
 	}
-	if ropts.ColorHeader == nil {
-		ropts.ColorHeader = brimtext.ANSIEscape.Bold
-	}
-	if ropts.ColorLink == nil {
-		ropts.ColorLink = brimtext.ANSIEscape.FBlue
-	}
-	if ropts.ColorImage == nil {
-		ropts.ColorImage = brimtext.ANSIEscape.FMagenta
-	}
-	if ropts.ColorCodeSpan == nil {
-		ropts.ColorCodeSpan = brimtext.ANSIEscape.FGreen
-	}
-	if ropts.ColorBlockCode == nil {
-		ropts.ColorBlockCode = brimtext.ANSIEscape.FGreen
-	}
-	if ropts.ColorStrikethrough == nil {
-		ropts.ColorStrikethrough = brimtext.ANSIEscape.FWhite
+	tty := isTerminal(os.Stdout)
+	if ropts.ColorMode == ColorModeAuto {
+		ropts.ColorMode = DetectColorMode(ropts.Getenv, tty)
 	}
-	if ropts.ColorEmphasis == nil {
-		ropts.ColorEmphasis = brimtext.ANSIEscape.FYellow
-	}
-	if ropts.ColorDoubleEmphasis == nil {
-		ropts.ColorDoubleEmphasis = brimtext.ANSIEscape.Bold
-	}
-	if ropts.ColorTripleEmphasis == nil {
-		var c []byte
-		c = append(c, brimtext.ANSIEscape.Bold...)
-		ropts.ColorTripleEmphasis = append(c, brimtext.ANSIEscape.FRed...)
+	switch ropts.ColorMode {
+	case ColorModeNone:
+		ropts.Color = false
+	case ColorMode16, ColorMode256:
+		ropts.Color = true
+	case ColorModeTrueColor:
+		ropts.Color = true
+		ropts.ImageTrueColor = true
 	}
 	if ropts.ColorReset == nil {
 		ropts.ColorReset = brimtext.ANSIEscape.Reset
 	}
 	if ropts.TableAlignOptions == nil {
-		if ropts.Color {
+		if ropts.Color && !ropts.ASCII {
 			ropts.TableAlignOptions = brimtext.NewUnicodeBoxedAlignOptions()
 		} else {
 			ropts.TableAlignOptions = brimtext.NewSimpleAlignOptions()
@@ -118,23 +192,29 @@ func resolveOpts(opts *Options) *Options {
 	if ropts.HeaderSuffix == nil {
 		ropts.HeaderSuffix = []byte("]--")
 	}
+	if ropts.Extensions == 0 {
+		ropts.Extensions = DefaultExtensions
+	}
+	ropts.Extensions &^= NoExtensions
+	if ropts.ImageProtocol == ImageProtocolAuto {
+		ropts.ImageProtocol = detectImageProtocol(ropts.Getenv, tty)
+	}
 	return ropts
 }
 
-const (
-	_               byte = iota // 0 NUL
-	markLineBreak               // 1 SOH
-	markNBSP                    // 2 STX
-	markIndentStart             // 3 ETX
-	markIndent1                 // 4 EOT
-	markIndent2                 // 5 ENQ
-	markIndentStop              // 6 ACK
-	markTableRow                // 7 BEL
-	markTableCell               // 8 BS
-	_                           // 9 TAB
-	_                           // 10 LF
-	markHRule                   // 11 VT
-)
+// DefaultExtensions are the Blackfriday extensions used to parse the
+// markdown unless Options.Extensions says otherwise.
+const DefaultExtensions = blackfriday.NoIntraEmphasis |
+	blackfriday.Tables |
+	blackfriday.FencedCode |
+	blackfriday.Autolink |
+	blackfriday.Strikethrough |
+	blackfriday.DefinitionLists
+
+// NoExtensions as Options.Extensions parses with no Blackfriday extensions,
+// as 0 means DefaultExtensions instead. It may be combined with others, so
+// NoExtensions|blackfriday.Tables parses with just tables.
+const NoExtensions blackfriday.Extensions = 1 << 30
 
 // MarkdownToText parses the markdown using the Blackfriday Markdown Processor
 // and an internal renderer to return any metadata and the formatted text. If
@@ -142,753 +222,618 @@ const (
 //
 // See MarkdownMetadata for a description of the [][]string metadata returned.
 func MarkdownToText(markdown []byte, opt *Options) ([][]string, []byte) {
-	metadata, position := MarkdownMetadata(markdown)
-	return metadata, MarkdownToTextNoMetadata(markdown[position:], opt)
+	metadata, position, _ := parseMetadata(markdown, false, opt)
+	return metadata, markdownToText(markdown[position:], NewMetadata(metadata), opt, nil)
 }
 
-// MarkdownMetadata parses just the metadata from the markdown and returns the
-// metadata and the position of the rest of the markdown.
-//
-// The metadata is a [][]string where each []string will have two elements, the
-// metadata item name and the value. Metadata is an extension of standard
-// Markdown and is documented at
-// https://github.com/fletcher/MultiMarkdown/wiki/MultiMarkdown-Syntax-Guide#metadata
-// -- this implementation currently differs in that it does not support
-// multiline values.
-//
-// In addition, the rest of markdown is scanned for lines containing only
-// "///".
-//
-// If there is one "///" line, the text above that mark is considered the
-// "Summary" metadata item; the summary will also be treated as part of the
-// content (with the "///" line omitted). This is known as a "soft break".
-//
-// If there are two "///" lines, one right after the other, the summary will
-// only be contained in the "Summary" metadata item and not part of the main
-// content. This is known as a "hard break".
-func MarkdownMetadata(markdown []byte) ([][]string, int) {
-	var metadata [][]string
-	pos := 0
-	for _, line := range bytes.Split(markdown, []byte("\n")) {
-		sline := strings.Trim(string(line), " ")
-		if sline == "" {
-			break
-		}
-		colon := strings.Index(sline, ":")
-		if colon == -1 {
-			// Since there's no blank line separating the metadata and content,
-			// we assume there wasn't actually any metadata.
-			metadata = make([][]string, 0)
-			pos = 0
-			break
-		}
-		name := strings.Trim(sline[:colon], " ")
-		value := strings.Trim(sline[colon+1:], " ")
-		metadata = append(metadata, []string{name, value})
-		pos += len(line) + 1
-	}
-	if pos > len(markdown) {
-		pos = len(markdown) - 1
-	}
-	pos2 := bytes.Index(markdown[pos:], []byte("\n///\n"))
-	if pos2 != -1 {
-		value := string(markdown[pos : pos+pos2])
-		metadata = append(metadata, []string{"Summary", value})
-		if string(markdown[pos+pos2+5:pos+pos2+9]) == "///\n" {
-			pos += pos2 + 9
-		}
-	}
-	return metadata, pos
+// MarkdownToTextMetadata is the same as MarkdownToText only returning the
+// metadata as Metadata.
+func MarkdownToTextMetadata(markdown []byte, opts *Options) (Metadata, []byte) {
+	items, position, _ := parseMetadata(markdown, false, opts)
+	metadata := NewMetadata(items)
+	return metadata, markdownToText(markdown[position:], metadata, opts, nil)
 }
 
 // MarkdownToTextNoMetadata is the same as MarkdownToText only skipping the
 // detection and parsing of any leading metadata. If opts is nil the defaults
 // will be used.
 func MarkdownToTextNoMetadata(markdown []byte, opts *Options) []byte {
+	return markdownToText(markdown, nil, opts, nil)
+}
+
+// textState is the rendering state carried from one part of a document to
+// the next, for Render.
+type textState struct {
+	// started is set once part of the document has been rendered, after
+	// which a Pandoc title block is no longer recognized.
+	started bool
+	// level is the number of header indentation levels open.
+	level int
+	// ends is how the text rendered so far ended, deciding the spacing
+	// before the next part.
+	ends lineEnds
+	// html is the renderer's state of the HTML elements still open, which
+	// may continue into the next part.
+	html htmlState
+}
+
+// markdownToText renders the markdown, with metadata supplying values for
+// opts.ExpandVariables. If state is not nil the markdown continues the
+// document it describes, and state is updated for the next part.
+func markdownToText(markdown []byte, metadata Metadata, opts *Options, state *textState) []byte {
 	opts = resolveOpts(opts)
-	rend := &renderer{
-		width:               opts.Width,
-		color:               opts.Color,
-		colorHeader:         opts.ColorHeader,
-		colorLink:           opts.ColorLink,
-		colorImage:          opts.ColorImage,
-		colorCodeSpan:       opts.ColorCodeSpan,
-		colorBlockCode:      opts.ColorBlockCode,
-		colorStrikethrough:  opts.ColorStrikethrough,
-		colorEmphasis:       opts.ColorEmphasis,
-		colorDoubleEmphasis: opts.ColorDoubleEmphasis,
-		colorTripleEmphasis: opts.ColorTripleEmphasis,
-		colorReset:          opts.ColorReset,
-		tableAlignOptions:   opts.TableAlignOptions,
-		headerPrefix:        opts.HeaderPrefix,
-		headerSuffix:        opts.HeaderSuffix,
-	}
-	markdown = bytes.Replace(markdown, []byte("\n///\n"), []byte(""), -1)
-	txt := blackfriday.Markdown(markdown, rend,
-		blackfriday.EXTENSION_NO_INTRA_EMPHASIS|
-			blackfriday.EXTENSION_TABLES|
-			blackfriday.EXTENSION_FENCED_CODE|
-			blackfriday.EXTENSION_AUTOLINK|
-			blackfriday.EXTENSION_STRIKETHROUGH|
-			blackfriday.EXTENSION_DEFINITION_LISTS)
-	for rend.level > 0 {
-		txt = append(txt, markIndentStop)
-		rend.level--
-	}
-	if len(txt) > 0 {
-		txt = bytes.Replace(txt, []byte(" \n"), []byte(" "), -1)
-		txt = bytes.Replace(txt, []byte("\n"), []byte(" "), -1)
-		txt = reflow(txt, opts.Indent1, opts.Indent2, rend.width)
-		txt = bytes.Replace(txt, []byte{markNBSP}, []byte(" "), -1)
-		txt = bytes.Replace(txt, []byte{markLineBreak}, []byte("\n"), -1)
+	pieces, indent1, openLine := markdownToPieces(markdown, metadata, opts, state)
+	var out bytes.Buffer
+	newLayout(opts).blocks(&out, newBlocks(pieces, nil), indent1, opts.Indent2)
+	txt := out.Bytes()
+	if openLine && len(txt) > 0 && txt[0] == '\n' {
+		// The part before already ended its last line.
+		txt = txt[1:]
 	}
 	return txt
 }
 
-type renderer struct {
-	width               int
-	currentIndent       int
-	color               bool
-	colorHeader         []byte
-	colorLink           []byte
-	colorImage          []byte
-	colorCodeSpan       []byte
-	colorBlockCode      []byte
-	colorStrikethrough  []byte
-	colorEmphasis       []byte
-	colorDoubleEmphasis []byte
-	colorTripleEmphasis []byte
-	colorReset          []byte
-	tableAlignOptions   *brimtext.AlignOptions
-	level               int
-	definitionList      [][]byte
-	headerPrefix        []byte
-	headerSuffix        []byte
-}
-
-func (rend *renderer) BlockCode(out *bytes.Buffer, text []byte, lang string) {
-	length := len(text)
-	if length > 0 && text[length-1] == '\n' {
-		text = text[:length-1]
-	}
-	rend.ensureBlankLine(out)
-	for _, line := range bytes.Split(text, []byte("\n")) {
-		if rend.color {
-			out.Write(rend.colorBlockCode)
-		}
-		out.Write(bytes.Replace(line, []byte(" "), []byte{markNBSP}, -1))
-		if rend.color {
-			out.Write(rend.colorReset)
+// markdownToPieces renders the markdown as markdownToText does, with opts
+// already through resolveOpts, returning the pieces to lay out, the indent
+// for their first line, and whether the part before left its last line
+// open.
+func markdownToPieces(markdown []byte, metadata Metadata, opts *Options, state *textState) ([]piece, []byte, bool) {
+	if state == nil {
+		state = &textState{}
+	}
+	if opts.ExpandVariables {
+		var unresolved []string
+		markdown, unresolved = ExpandVariables(markdown, metadata, opts)
+		if opts.UnresolvedVariable != nil {
+			for _, name := range unresolved {
+				opts.UnresolvedVariable(name)
+			}
 		}
-		out.WriteByte(markLineBreak)
-	}
-	rend.ensureBlankLine(out)
-}
-
-func (rend *renderer) BlockQuote(out *bytes.Buffer, text []byte) {
-	rend.ensureBlankLine(out)
-	out.WriteByte(markIndentStart)
-	out.WriteString("> ")
-	out.WriteByte(markIndent1)
-	out.WriteString("> ")
-	out.WriteByte(markIndent2)
-	rend.currentIndent += 2
-	out.Write(bytes.Trim(text, string([]byte{markLineBreak})))
-	out.WriteByte(markIndentStop)
-	rend.currentIndent -= 2
-}
-
-func (rend *renderer) BlockHtml(out *bytes.Buffer, text []byte) {
-	rend.ensureBlankLine(out)
-	out.Write(bytes.Replace(text, []byte("\n"), []byte{markLineBreak}, -1))
-}
-
-func (rend *renderer) Header(out *bytes.Buffer, text func() bool, level int, id string) {
-	oPos := out.Len()
-	rend.ensureBlankLine(out)
-	oLevel := rend.level
-	level--
-	for rend.level > level {
-		out.WriteByte(markIndentStop)
-		rend.currentIndent -= 4
-		rend.level--
 	}
-	if len(rend.headerPrefix) > 0 {
-		out.WriteByte(markIndentStart)
-		out.Write(rend.headerPrefix)
-		out.WriteByte(markNBSP)
-		out.WriteByte(markIndent1)
-		for i := 0; i <= len(rend.headerPrefix); i++ {
-			out.WriteByte(' ')
-		}
-		out.WriteByte(markIndent2)
-		rend.currentIndent += len(rend.headerPrefix) + 1
-	}
-	if rend.color {
-		out.Write(rend.colorHeader)
-	}
-	if !text() {
-		out.Truncate(oPos)
-		rend.level = oLevel
-		return
-	}
-	if rend.color {
-		out.Write(rend.colorReset)
-	}
-	if len(rend.headerSuffix) > 0 {
-		out.WriteByte(markNBSP)
-		out.Write(rend.headerSuffix)
-	}
-	if len(rend.headerPrefix) > 0 {
-		out.WriteByte(markIndentStop)
-		rend.currentIndent -= len(rend.headerPrefix) + 1
-	}
-	for rend.level <= level {
-		out.WriteByte(markIndentStart)
-		out.WriteString("    ")
-		out.WriteByte(markIndent1)
-		out.WriteString("    ")
-		out.WriteByte(markIndent2)
+	rend := &renderer{
+		width:            opts.Width,
+		color:            opts.Color,
+		layout:           newLayout(opts),
+		headerPrefix:     opts.HeaderPrefix,
+		headerSuffix:     opts.HeaderSuffix,
+		baseIndent:       len(opts.Indent2),
+		imageProtocol:    opts.ImageProtocol,
+		imageDir:         opts.ImageDir,
+		imageMaxWidth:    opts.ImageMaxWidth,
+		imageMaxHeight:   opts.ImageMaxHeight,
+		imageTrueColor:   opts.ImageTrueColor,
+		colorMode:        opts.ColorMode,
+		ascii:            opts.ASCII,
+		htmlPolicy:       opts.HTML,
+		smartPunctuation: opts.SmartPunctuation && !opts.ASCII,
+	}
+	if !opts.NoSummary {
+		markdown = stripSummaryMarkers(markdown, opts.SummaryMarkers)
+	}
+	// Pandoc title blocks are only recognized at the very start, unlike
+	// Blackfriday's Titleblock extension.
+	var prefix textBuffer
+	if tb, pos := titleBlock(markdown); !state.started && tb != nil {
+		rend.titleBlock(&prefix, markdown[:pos])
+		prefix.lineBreak()
+		markdown = markdown[pos:]
+	}
+	indent1 := opts.Indent1
+	if state.started {
+		indent1 = opts.Indent2
+	}
+	state.started = true
+	// The last line of the part before is left open if it did not end with
+	// a line break, which the layout ends anyway.
+	openLine := state.ends.last == endOpen
+	// Content continues at the indentation of the last header.
+	for rend.level < state.level {
+		prefix.startGroup([]byte("    "), []byte("    "))
 		rend.currentIndent += 4
 		rend.level++
 	}
-	rend.ensureBlankLine(out)
-}
-
-func (rend *renderer) HRule(out *bytes.Buffer) {
-	rend.ensureBlankLine(out)
-	out.WriteByte(markHRule)
-	out.WriteByte('-')
-	rend.ensureBlankLine(out)
-}
-
-func (rend *renderer) List(out *bytes.Buffer, text func() bool, flags int) {
-	oPos := out.Len()
-	rend.ensureNewLine(out)
-	if !text() {
-		out.Truncate(oPos)
-		return
-	}
-	if len(rend.definitionList) > 0 {
-		dl := rend.definitionList
-		rend.definitionList = nil
-		max := 0
-		for i, v := range dl {
-			if i%2 == 0 && len(v) > max {
-				max = len(v)
-			}
+	// And within any HTML elements still open.
+	rend.htmlState = state.html.copy()
+	for _, g := range rend.htmlOpen {
+		if g.indent != "" {
+			prefix.startGroup([]byte(g.indent), []byte(g.indent))
+			rend.currentIndent += len(g.indent)
 		}
-		if max > 0 {
-			max += 2
-		}
-		rend.ensureBlankLine(out)
-		for i := 0; i < len(dl)-1; i += 2 {
-			rend.ensureNewLine(out)
-			out.WriteByte(markIndentStart)
-			t := bytes.Trim(dl[i], string([]byte{markLineBreak}))
-			out.Write(t)
-			for i := len(t); i < max; i++ {
-				out.WriteByte(' ')
-			}
-			out.WriteByte(markIndent1)
-			for i := 0; i < max; i++ {
-				out.WriteByte(' ')
+	}
+	doc := &textBuffer{before: state.ends, ends: state.ends}
+	rend.out = []*textBuffer{doc}
+	nodeRenderer := opts.Renderer
+	if nodeRenderer == nil {
+		nodeRenderer = BaseRenderer{}
+	}
+	w := &Writer{rend: rend}
+	parse(markdown, opts.Parser, opts.Extensions).Walk(func(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		return nodeRenderer.RenderNode(w, node, entering)
+	})
+	all := &textBuffer{before: state.ends, ends: state.ends}
+	all.append(&prefix)
+	all.append(doc)
+	// The part before already ended its last line if the first piece
+	// ending a line here ends a group it left open.
+	if openLine {
+	first:
+		for _, p := range all.pieces {
+			switch p.kind {
+			case pieceGroup, pieceStyle, pieceStyleEnd:
+			case pieceEnd:
+				openLine = false
+				break first
+			default:
+				break first
 			}
-			out.WriteByte(markIndent2)
-			rend.currentIndent += max
-			out.Write(bytes.Trim(dl[i+1], string([]byte{markLineBreak})))
-			out.WriteByte(markIndentStop)
-			rend.currentIndent -= max
 		}
 	}
-}
-
-func (rend *renderer) ListItem(out *bytes.Buffer, text []byte, flags int) {
-	if flags&blackfriday.LIST_TYPE_DEFINITION != 0 {
-		rend.definitionList = append(rend.definitionList, text)
-	} else {
-		rend.ensureNewLine(out)
-		out.WriteByte(markIndentStart)
-		out.WriteString("  * ")
-		out.WriteByte(markIndent1)
-		out.WriteString("    ")
-		out.WriteByte(markIndent2)
-		rend.currentIndent += 4
-		out.Write(bytes.Trim(text, string([]byte{markLineBreak})))
-		out.WriteByte(markIndentStop)
-		rend.currentIndent -= 4
+	state.level = rend.level
+	state.ends = all.ends
+	state.html = rend.htmlState.copy()
+	for _, g := range rend.htmlOpen {
+		if g.indent != "" {
+			all.endGroup()
+		}
 	}
-}
-
-func (rend *renderer) Paragraph(out *bytes.Buffer, text func() bool) {
-	rend.ensureBlankLine(out)
-	oPos := out.Len()
-	if !text() {
-		out.Truncate(oPos)
+	for rend.level > 0 {
+		all.endGroup()
+		rend.level--
 	}
+	return all.pieces, indent1, openLine
 }
 
-func (rend *renderer) Table(out *bytes.Buffer, header []byte, body []byte, columnData []int) {
-	opts := &brimtext.AlignOptions{}
-	*opts = *rend.tableAlignOptions
-	opts.Widths = make([]int, len(columnData))
-	opts.Alignments = make([]brimtext.Alignment, len(columnData))
-	var data [][]string
-	rows := bytes.Split(header[:len(header)-1], []byte{markTableRow})
-	for _, row := range rows {
-		var headerRow []string
-		cells := bytes.Split(row[:len(row)-1], []byte{markTableCell})
-		for c, cell := range cells {
-			if columnData[c]&blackfriday.TABLE_ALIGNMENT_CENTER == blackfriday.TABLE_ALIGNMENT_CENTER {
-				opts.Alignments[c] = brimtext.Center
-			} else if columnData[c]&blackfriday.TABLE_ALIGNMENT_RIGHT != 0 {
-				opts.Alignments[c] = brimtext.Right
-			}
-			cellString := string(cell)
-			if ln := brimtext.RuneLenStripANSIEscapes(cellString); ln > opts.Widths[c] {
-				opts.Widths[c] = ln
-			}
-			headerRow = append(headerRow, cellString)
+// renderer renders the nodes of the parsed Markdown into textBuffers;
+// markdownToText lays out the text once the whole document is rendered.
+type renderer struct {
+	width            int
+	currentIndent    int
+	color            bool
+	level            int
+	definitionList   []*textBuffer
+	headerPrefix     []byte
+	headerSuffix     []byte
+	baseIndent       int
+	imageProtocol    ImageProtocol
+	imageDir         string
+	imageMaxWidth    int
+	imageMaxHeight   int
+	imageTrueColor   bool
+	colorMode        ColorMode
+	ascii            bool
+	htmlPolicy       HTMLPolicy
+	smartPunctuation bool
+	htmlState
+	// out is the stack of buffers being rendered into; the first is the
+	// document and others hold the content of the enclosing nodes until
+	// they are complete.
+	out []*textBuffer
+	// table is the table being rendered, if any.
+	table *tableData
+	// layout is how the text will be laid out, for the few parts the
+	// renderer must style itself.
+	layout *layout
+}
+
+// tableData collects the cells of a table as it is rendered.
+type tableData struct {
+	table Table
+	row   []TableCell
+}
+
+func (rend *renderer) push() {
+	rend.out = append(rend.out, &textBuffer{})
+}
+
+func (rend *renderer) pop() *textBuffer {
+	n := len(rend.out) - 1
+	out := rend.out[n]
+	rend.out = rend.out[:n]
+	return out
+}
+
+func (rend *renderer) top() *textBuffer {
+	return rend.out[len(rend.out)-1]
+}
+
+// renderNode renders the node as BaseRenderer does.
+func (rend *renderer) renderNode(node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.BlockQuote, blackfriday.Item, blackfriday.Del, blackfriday.Link, blackfriday.TableCell:
+		// Their content is rendered on its own and then added.
+		if entering {
+			rend.push()
+			return blackfriday.GoToNext
 		}
-		if len(headerRow) > 0 && headerRow[0] != "omit" {
-			data = append(data, headerRow)
+	case blackfriday.Emph, blackfriday.Strong:
+		if tripleEmphasis(node.Parent) {
+			// The enclosing Strong renders both.
+			return blackfriday.GoToNext
+		}
+		if entering {
+			rend.push()
+			return blackfriday.GoToNext
 		}
 	}
-	if len(data) > 0 {
-		data = append(data, nil)
-	}
-	rows = bytes.Split(body[:len(body)-1], []byte{markTableRow})
-	for _, row := range rows {
-		if len(row) == 0 {
-			continue
+	switch node.Type {
+	case blackfriday.BlockQuote:
+		text := rend.pop()
+		rend.blockQuote(rend.top(), text)
+	case blackfriday.List:
+		if entering && node.IsFootnotesList {
+			rend.top().ensureBlankLine()
+		} else if entering {
+			rend.top().ensureNewLine()
+		} else {
+			rend.definitions(rend.top())
 		}
-		var bodyRow []string
-		cells := bytes.Split(row[:len(row)-1], []byte{markTableCell})
-		for c, cell := range cells {
-			cellString := string(cell)
-			if ln := brimtext.RuneLenStripANSIEscapes(cellString); ln > opts.Widths[c] {
-				opts.Widths[c] = ln
+	case blackfriday.Item:
+		text := rend.pop()
+		if node.Parent.IsFootnotesList {
+			number := 1
+			for prev := node.Prev; prev != nil; prev = prev.Prev {
+				number++
 			}
-			bodyRow = append(bodyRow, cellString)
+			rend.footnote(rend.top(), text, number)
+		} else {
+			rend.listItem(rend.top(), text, node.ListFlags)
 		}
-		data = append(data, bodyRow)
-	}
-	overheadw := rend.currentIndent + brimtext.RuneLenStripANSIEscapes(opts.RowFirstUD) + brimtext.RuneLenStripANSIEscapes(opts.RowLastUD)
-	if len(columnData) > 1 {
-		overheadw += brimtext.RuneLenStripANSIEscapes(opts.RowSecondUD)
-	}
-	if len(columnData) > 2 {
-		overheadw += brimtext.RuneLenStripANSIEscapes(opts.RowUD) * (len(columnData) - 2)
-	}
-	aw := rend.width - overheadw
-	cw := 0
-	for _, w := range opts.Widths {
-		cw += w
-	}
-	ocw := cw
-	for cw > aw {
-		for i := 0; i < len(opts.Widths); i++ {
-			if opts.Widths[i] > 1 {
-				opts.Widths[i]--
-			}
+	case blackfriday.Paragraph:
+		// Items of tight lists are not separated by blank lines.
+		if entering && (node.Parent.Type != blackfriday.Item || !node.Parent.Parent.Tight) {
+			rend.top().ensureBlankLine()
 		}
-		cw = 0
-		for _, w := range opts.Widths {
-			cw += w
+	case blackfriday.Heading:
+		if node.IsTitleblock {
+			// Only Blackfriday's Titleblock extension finds these beyond
+			// the start of the document.
+			rend.titleBlock(rend.top(), append([]byte("% "), bytes.Replace(literalText(node), []byte("\n"), []byte("\n% "), -1)...))
+			return blackfriday.SkipChildren
 		}
-		if cw == ocw {
-			break
+		if entering {
+			rend.headingStart(rend.top(), node.Level)
+		} else {
+			rend.headingEnd(rend.top(), node.Level)
 		}
-		ocw = cw
-	}
-	var text string
-	for {
-		good := true
-		text = brimtext.Align(data, opts)
-		for _, line := range strings.Split(text, "\n") {
-			if brimtext.RuneLenStripANSIEscapes(line)-overheadw > aw {
-				good = false
-			}
+	case blackfriday.HorizontalRule:
+		rend.hRule(rend.top())
+	case blackfriday.Emph:
+		text := rend.pop()
+		rend.style(rend.top(), text, ElementEmphasis)
+	case blackfriday.Strong:
+		text := rend.pop()
+		if tripleEmphasis(node) {
+			rend.style(rend.top(), text, ElementTripleEmphasis)
+		} else {
+			rend.style(rend.top(), text, ElementDoubleEmphasis)
 		}
-		if good {
-			break
+	case blackfriday.Del:
+		text := rend.pop()
+		rend.style(rend.top(), text, ElementStrikethrough)
+	case blackfriday.Link:
+		content := rend.pop()
+		if node.NoteID > 0 {
+			rend.footnoteRef(rend.top(), node.NoteID)
+		} else {
+			rend.link(rend.top(), node.LinkData.Destination, node.LinkData.Title, content)
 		}
-		ocw = cw
-		for i := 0; i < len(opts.Widths); i++ {
-			if opts.Widths[i] > 1 {
-				opts.Widths[i]--
-			}
+	case blackfriday.Image:
+		rend.image(rend.top(), node.LinkData.Destination, node.LinkData.Title, literalText(node))
+		return blackfriday.SkipChildren
+	case blackfriday.Text:
+		rend.text(rend.top(), node.Literal, !isDestinationText(node.Parent))
+	case blackfriday.HTMLBlock:
+		rend.html(rend.top(), node.Literal, true)
+	case blackfriday.CodeBlock:
+		rend.blockCode(rend.top(), node.Literal)
+	case blackfriday.Hardbreak:
+		rend.top().lineBreak()
+	case blackfriday.Code:
+		rend.codeSpan(rend.top(), node.Literal)
+	case blackfriday.HTMLSpan:
+		rend.html(rend.top(), node.Literal, false)
+	case blackfriday.Table:
+		if entering {
+			rend.table = &tableData{}
+		} else {
+			rend.renderTable(rend.top(), &rend.table.table)
+			rend.table = nil
 		}
-		cw = 0
-		for _, w := range opts.Widths {
-			cw += w
+	case blackfriday.TableRow:
+		if !entering {
+			if node.Parent.Type == blackfriday.TableHead {
+				rend.table.table.Header = append(rend.table.table.Header, rend.table.row)
+			} else {
+				rend.table.table.Body = append(rend.table.table.Body, rend.table.row)
+			}
+			rend.table.row = nil
 		}
-		if cw == ocw {
-			break
+	case blackfriday.TableCell:
+		text := rend.pop()
+		rend.table.row = append(rend.table.row, TableCell{Spans: appendSpans(nil, text.pieces, &[]Element{})})
+		if node.TableCellData.IsHeader {
+			alignment := brimtext.Left
+			switch node.TableCellData.Align {
+			case blackfriday.TableAlignmentCenter:
+				alignment = brimtext.Center
+			case blackfriday.TableAlignmentRight:
+				alignment = brimtext.Right
+			}
+			rend.table.table.Alignments = append(rend.table.table.Alignments, alignment)
 		}
 	}
-	textBytes := []byte(text)
-	textBytes = bytes.Replace(textBytes, []byte{' '}, []byte{markNBSP}, -1)
-	textBytes = bytes.Replace(textBytes, []byte{'\n'}, []byte{markLineBreak}, -1)
-	rend.ensureBlankLine(out)
-	out.Write(textBytes)
-}
-
-func (rend *renderer) TableRow(out *bytes.Buffer, text []byte) {
-	out.Write(text)
-	out.WriteByte(markTableRow)
-}
-
-func (rend *renderer) TableHeaderCell(out *bytes.Buffer, text []byte, flags int) {
-	out.Write(text)
-	out.WriteByte(markTableCell)
-}
-
-func (rend *renderer) TableCell(out *bytes.Buffer, text []byte, flags int) {
-	out.Write(text)
-	out.WriteByte(markTableCell)
-}
-
-func (rend *renderer) Footnotes(out *bytes.Buffer, text func() bool) {
-	oPos := out.Len()
-	rend.ensureBlankLine(out)
-	if !text() {
-		out.Truncate(oPos)
-		return
-	}
-}
-
-func (rend *renderer) FootnoteItem(out *bytes.Buffer, name, text []byte, flags int) {
-	out.Write(text)
-	out.WriteByte('[')
-	out.Write(name)
-	out.WriteByte(']')
+	return blackfriday.GoToNext
 }
 
-func (rend *renderer) TitleBlock(out *bytes.Buffer, text []byte) {
-	text = bytes.TrimPrefix(text, []byte("% "))
-	text = bytes.Replace(text, []byte("\n% "), []byte("\n"), -1)
-	out.Write(text)
-}
-
-func (rend *renderer) AutoLink(out *bytes.Buffer, link []byte, kind int) {
-	if rend.color {
-		out.Write(rend.colorLink)
+// tripleEmphasis returns true if the node is a Strong holding just an Emph,
+// as from "***text***".
+func tripleEmphasis(node *blackfriday.Node) bool {
+	if node == nil || node.Type != blackfriday.Strong {
+		return false
 	}
-	out.Write(link)
-	if rend.color {
-		out.Write(rend.colorReset)
+	var only *blackfriday.Node
+	for child := node.FirstChild; child != nil; child = child.Next {
+		if child.Type == blackfriday.Text && len(child.Literal) == 0 {
+			continue
+		}
+		if only != nil {
+			return false
+		}
+		only = child
 	}
+	return only != nil && only.Type == blackfriday.Emph
 }
 
-func (rend *renderer) CodeSpan(out *bytes.Buffer, text []byte) {
-	if rend.color {
-		out.Write(rend.colorCodeSpan)
-	} else {
-		out.WriteByte('"')
-	}
-	out.Write(bytes.Replace(text, []byte(" "), []byte{markNBSP}, -1))
-	if rend.color {
-		out.Write(rend.colorReset)
-	} else {
-		out.WriteByte('"')
-	}
+// literalText returns the text of the node's descendants as written, such
+// as the alt text of an image.
+func literalText(node *blackfriday.Node) []byte {
+	var text []byte
+	node.Walk(func(n *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		if entering && n != node {
+			text = append(text, n.Literal...)
+		}
+		return blackfriday.GoToNext
+	})
+	return text
 }
 
-func (rend *renderer) DoubleEmphasis(out *bytes.Buffer, text []byte) {
-	if rend.color {
-		out.Write(rend.colorDoubleEmphasis)
-	} else {
-		out.WriteString("**")
-	}
-	out.Write(text)
-	if rend.color {
-		out.Write(rend.colorReset)
-	} else {
-		out.WriteString("**")
+func (rend *renderer) blockCode(out *textBuffer, text []byte) {
+	length := len(text)
+	if length > 0 && text[length-1] == '\n' {
+		text = text[:length-1]
 	}
-}
-
-func (rend *renderer) Emphasis(out *bytes.Buffer, text []byte) {
-	if rend.color {
-		out.Write(rend.colorEmphasis)
-	} else {
-		out.WriteByte('*')
+	out.ensureBlankLine()
+	for _, line := range bytes.Split(text, []byte("\n")) {
+		out.startStyle(ElementBlockCode)
+		out.writeNoWrap(line)
+		out.endStyle(ElementBlockCode)
+		out.lineBreak()
+	}
+	out.ensureBlankLine()
+}
+
+func (rend *renderer) blockQuote(out *textBuffer, text *textBuffer) {
+	out.ensureBlankLine()
+	out.startGroup([]byte("> "), []byte("> "))
+	text.trimBreaks()
+	out.startStyle(ElementBlockQuote)
+	out.append(text)
+	out.endStyle(ElementBlockQuote)
+	out.endGroup()
+}
+
+func (rend *renderer) headingStart(out *textBuffer, level int) {
+	// Header indentation can't nest inside HTML elements, so any still open
+	// are closed.
+	rend.htmlCloseGroups(out, 0)
+	out.ensureBlankLine()
+	e := headerElement(level)
+	level--
+	for rend.level > level {
+		out.endGroup()
+		rend.currentIndent -= 4
+		rend.level--
 	}
-	out.Write(text)
-	if rend.color {
-		out.Write(rend.colorReset)
-	} else {
-		out.WriteByte('*')
+	if len(rend.headerPrefix) > 0 {
+		out.startGroup(append(append([]byte(nil), rend.headerPrefix...), ' '), bytes.Repeat([]byte(" "), len(rend.headerPrefix)+1))
+		rend.currentIndent += len(rend.headerPrefix) + 1
 	}
+	out.startStyle(ElementHeader)
+	out.startStyle(e)
 }
 
-func (rend *renderer) Image(out *bytes.Buffer, link []byte, title []byte, alt []byte) {
-	if rend.color {
-		out.Write(rend.colorImage)
+func (rend *renderer) headingEnd(out *textBuffer, level int) {
+	out.endStyle(headerElement(level))
+	out.endStyle(ElementHeader)
+	if len(rend.headerSuffix) > 0 {
+		out.writeNoWrap([]byte(" "))
+		out.write(rend.headerSuffix)
 	}
-	if len(alt) > 0 {
-		out.WriteByte('[')
-		out.Write(alt)
-		out.WriteByte(']')
-		out.WriteByte(' ')
-	} else if len(title) > 0 {
-		out.WriteByte('[')
-		out.Write(title)
-		out.WriteByte(']')
-		out.WriteByte(' ')
+	if len(rend.headerPrefix) > 0 {
+		out.endGroup()
+		rend.currentIndent -= len(rend.headerPrefix) + 1
 	}
-	out.Write(link)
-	if rend.color {
-		out.Write(rend.colorReset)
+	for rend.level < level {
+		out.startGroup([]byte("    "), []byte("    "))
+		rend.currentIndent += 4
+		rend.level++
 	}
+	out.ensureBlankLine()
 }
 
-func (rend *renderer) LineBreak(out *bytes.Buffer) {
-	out.WriteByte(markLineBreak)
+func (rend *renderer) hRule(out *textBuffer) {
+	out.ensureBlankLine()
+	out.rule('-')
+	out.ensureBlankLine()
 }
 
-func (rend *renderer) Link(out *bytes.Buffer, link []byte, title []byte, content []byte) {
-	if rend.color {
-		out.Write(rend.colorLink)
-	}
-	if len(content) > 0 && !bytes.Equal(content, link) {
-		out.WriteByte('[')
-		out.Write(content)
-		out.WriteByte(']')
-		out.WriteByte(' ')
-	} else if len(title) > 0 && !bytes.Equal(title, link) {
-		out.WriteByte('[')
-		out.Write(title)
-		out.WriteByte(']')
-		out.WriteByte(' ')
+// definitions writes the definition list collected from the items of the
+// list just rendered, if it was one, with the definitions aligned after
+// their terms.
+func (rend *renderer) definitions(out *textBuffer) {
+	if len(rend.definitionList) == 0 {
+		return
 	}
-	out.Write(link)
-	if rend.color {
-		out.Write(rend.colorReset)
+	dl := rend.definitionList
+	rend.definitionList = nil
+	terms := make([][]byte, len(dl))
+	max := 0
+	for i := 0; i < len(dl); i += 2 {
+		dl[i].trimBreaks()
+		terms[i] = dl[i].flatten(" ", rend.layout)
+		if len(terms[i]) > max {
+			max = len(terms[i])
+		}
 	}
-}
-
-func (rend *renderer) RawHtmlTag(out *bytes.Buffer, tag []byte) {
-	out.Write(tag)
-}
-
-func (rend *renderer) TripleEmphasis(out *bytes.Buffer, text []byte) {
-	if rend.color {
-		out.Write(rend.colorTripleEmphasis)
-	} else {
-		out.WriteString("***")
+	if max > 0 {
+		max += 2
 	}
-	out.Write(text)
-	if rend.color {
-		out.Write(rend.colorReset)
-	} else {
-		out.WriteString("***")
+	out.ensureBlankLine()
+	for i := 0; i < len(dl)-1; i += 2 {
+		out.ensureNewLine()
+		indent1 := append(terms[i], bytes.Repeat([]byte(" "), max-len(terms[i]))...)
+		out.startGroup(indent1, bytes.Repeat([]byte(" "), max))
+		rend.currentIndent += max
+		dl[i+1].trimBreaks()
+		out.append(dl[i+1])
+		out.endGroup()
+		rend.currentIndent -= max
 	}
 }
 
-func (rend *renderer) StrikeThrough(out *bytes.Buffer, text []byte) {
-	if rend.color {
-		out.Write(rend.colorStrikethrough)
-	} else {
-		out.WriteString("~~")
+func (rend *renderer) listItem(out *textBuffer, text *textBuffer, flags blackfriday.ListType) {
+	if flags&blackfriday.ListTypeDefinition != 0 {
+		rend.definitionList = append(rend.definitionList, text)
+		return
 	}
-	out.Write(text)
-	if rend.color {
-		out.Write(rend.colorReset)
-	} else {
-		out.WriteString("~~")
+	out.ensureNewLine()
+	out.startGroup([]byte("  * "), []byte("    "))
+	rend.currentIndent += 4
+	text.trimBreaks()
+	out.append(text)
+	out.endGroup()
+	rend.currentIndent -= 4
+}
+
+// footnote writes the text of a footnote, from the list Blackfriday
+// collects at the end of the document, after its number.
+func (rend *renderer) footnote(out *textBuffer, text *textBuffer, number int) {
+	out.ensureNewLine()
+	indent1 := []byte("[" + strconv.Itoa(number) + "] ")
+	out.startGroup(indent1, bytes.Repeat([]byte(" "), len(indent1)))
+	rend.currentIndent += len(indent1)
+	text.trimBreaks()
+	out.append(text)
+	out.endGroup()
+	rend.currentIndent -= len(indent1)
+}
+
+// footnoteRef writes the number of the footnote referred to.
+func (rend *renderer) footnoteRef(out *textBuffer, number int) {
+	out.startStyle(ElementLink)
+	out.writeString("[" + strconv.Itoa(number) + "]")
+	out.endStyle(ElementLink)
+}
+
+// table writes the table collected, leaving its layout until the width
+// available is known.
+func (rend *renderer) renderTable(out *textBuffer, table *Table) {
+	out.ensureBlankLine()
+	out.table(table)
+}
+
+func (rend *renderer) titleBlock(out *textBuffer, text []byte) {
+	metadata, _ := titleBlock(text)
+	banner := titleBanner(metadata, rend.width-rend.baseIndent, rend.color, rend.layout.start(ElementHeader), rend.layout.end(ElementHeader))
+	out.ensureBlankLine()
+	for i, line := range bytes.Split(banner, []byte("\n")) {
+		if i > 0 {
+			out.lineBreak()
+		}
+		out.writeNoWrap(line)
 	}
 }
 
-func (rend *renderer) FootnoteRef(out *bytes.Buffer, ref []byte, id int) {
-	out.Write(ref)
-	out.WriteString(" [")
-	out.WriteString(fmt.Sprintf("%d", id))
-	out.WriteByte(']')
-}
-
-func (rend *renderer) Entity(out *bytes.Buffer, entity []byte) {
-	out.Write(entity)
-}
-
-func (rend *renderer) NormalText(out *bytes.Buffer, text []byte) {
-	out.Write(text)
-}
-
-func (rend *renderer) DocumentHeader(out *bytes.Buffer) {
+func (rend *renderer) codeSpan(out *textBuffer, text []byte) {
+	out.startStyle(ElementCodeSpan)
+	out.writeNoWrap(text)
+	out.endStyle(ElementCodeSpan)
 }
 
-func (rend *renderer) DocumentFooter(out *bytes.Buffer) {
+// style writes the text styled as the element.
+func (rend *renderer) style(out *textBuffer, text *textBuffer, e Element) {
+	out.startStyle(e)
+	out.append(text)
+	out.endStyle(e)
 }
 
-func (rend *renderer) GetFlags() int {
-	return 0
-}
-
-func (rend *renderer) ensureNewLine(out *bytes.Buffer) {
-	bs := out.Bytes()
-	bsLen := len(bs)
-	if bsLen > 0 {
-		last := bs[bsLen-1]
-		if last != markLineBreak && last != markIndent2 && last != markIndentStop {
-			out.WriteByte(markLineBreak)
+func (rend *renderer) image(out *textBuffer, link []byte, title []byte, alt []byte) {
+	if rend.imageProtocol != ImageProtocolNone && rend.table == nil {
+		if lines := rend.inlineImage(link); lines != nil {
+			out.ensureNewLine()
+			for _, line := range lines {
+				out.raw(line)
+				out.lineBreak()
+			}
+			return
 		}
 	}
+	out.startStyle(ElementImage)
+	if len(alt) > 0 {
+		out.writeString("[")
+		out.write(alt)
+		out.writeString("] ")
+	} else if len(title) > 0 {
+		out.writeString("[")
+		out.write(title)
+		out.writeString("] ")
+	}
+	out.write(link)
+	out.endStyle(ElementImage)
 }
 
-func (rend *renderer) ensureBlankLine(out *bytes.Buffer) {
-	bs := out.Bytes()
-	bsLen := len(bs)
-	if bsLen == 1 {
-		first := bs[0]
-		if first != markLineBreak && first != markIndent2 && first != markIndentStop {
-			out.WriteByte(markLineBreak)
-			out.WriteByte(markLineBreak)
-		} else {
-			out.WriteByte(markLineBreak)
-		}
-	} else if bsLen > 1 {
-		last := bs[bsLen-1]
-		if last != markLineBreak && last != markIndent2 && last != markIndentStop {
-			out.WriteByte(markLineBreak)
-			out.WriteByte(markLineBreak)
-		} else {
-			secondLast := bs[bsLen-2]
-			if secondLast != markLineBreak && secondLast != markIndent2 && secondLast != markIndentStop {
-				out.WriteByte(markLineBreak)
-			}
-		}
+func (rend *renderer) link(out *textBuffer, link []byte, title []byte, content *textBuffer) {
+	text := content.flatten(" ", nil)
+	if bytes.HasPrefix(link, []byte("mailto:")) && bytes.Equal(text, link[len("mailto:"):]) {
+		// An email autolink is shown as written.
+		link = text
+	}
+	out.startStyle(ElementLink)
+	if len(text) > 0 && !bytes.Equal(text, link) {
+		out.writeString("[")
+		out.append(content)
+		out.writeString("] ")
+	} else if len(title) > 0 && !bytes.Equal(title, link) {
+		out.writeString("[")
+		out.write(title)
+		out.writeString("] ")
 	}
+	out.write(link)
+	out.endStyle(ElementLink)
 }
 
-func reflow(text []byte, indent1 []byte, indent2 []byte, width int) []byte {
-	var out bytes.Buffer
-	for {
-		start := bytes.IndexByte(text, markIndentStart)
-		if start >= 0 {
-			out.Write(wrapBytes(text[:start], width, indent1, indent2))
-			if out.Len() > 0 {
-				indent1 = indent2
-			}
-			text = text[start+1:]
-			nested := 1
-			stop := bytes.IndexByte(text, markIndentStop)
-			start = bytes.IndexByte(text, markIndentStart)
-			for {
-				if start == -1 || stop < start {
-					nested--
-					if nested == 0 {
-						break
-					}
-					start = stop
-				} else {
-					nested++
-				}
-				if start == -1 {
-					start = stop + 1
-				}
-				nextStop := bytes.IndexByte(text[start+1:], markIndentStop)
-				if nextStop > -1 {
-					nextStop += start + 1
-				}
-				stop = nextStop
-				nextStart := bytes.IndexByte(text[start+1:], markIndentStart)
-				if nextStart > -1 {
-					nextStart += start + 1
-				}
-				start = nextStart
-			}
-			innerRawText := text[:stop]
-			text = text[stop+1:]
-			indent1Marker := bytes.IndexByte(innerRawText, markIndent1)
-			innerIndent1 := bytes.Join(
-				[][]byte{indent1, innerRawText[:indent1Marker]}, []byte{})
-			innerRawText = innerRawText[indent1Marker+1:]
-			indent2Marker := bytes.IndexByte(innerRawText, markIndent2)
-			innerIndent2 := bytes.Join(
-				[][]byte{indent2, innerRawText[:indent2Marker]}, []byte{})
-			innerRawText = innerRawText[indent2Marker+1:]
-			out.Write(reflow(innerRawText, innerIndent1, innerIndent2, width))
-			if out.Len() > 0 {
-				indent1 = indent2
-			}
-		} else {
-			out.Write(wrapBytes(text, width, indent1, indent2))
-			if out.Len() > 0 {
-				indent1 = indent2
-			}
-			break
-		}
+// isDestinationText returns true if the node is a link whose text is its
+// destination, as that of autolinks is, which is shown just as written.
+func isDestinationText(node *blackfriday.Node) bool {
+	if node == nil || node.Type != blackfriday.Link {
+		return false
 	}
-	return out.Bytes()
+	return bytes.Equal(literalText(node), bytes.TrimPrefix(node.LinkData.Destination, []byte("mailto:")))
 }
 
-func wrapBytes(text []byte, width int, indent1 []byte, indent2 []byte) []byte {
-	if len(text) == 0 {
-		return text
+// text writes a Text node, which Blackfriday makes of each HTML entity on
+// its own, with smart punctuation if smart is set and the options say to.
+func (rend *renderer) text(out *textBuffer, text []byte, smart bool) {
+	if len(text) > 1 && text[0] == '&' && text[len(text)-1] == ';' && bytes.IndexAny(text, " \t\n") == -1 {
+		rend.writeEntities(out, text, false)
+		return
 	}
-	textLen := len(text)
-	if textLen > 0 && text[textLen-1] == markLineBreak {
-		text = text[:textLen-1]
+	if rend.htmlSkip > 0 {
+		return
 	}
-	var out bytes.Buffer
-	for _, line := range bytes.Split(text, []byte{markLineBreak}) {
-		if len(line) == 2 && line[0] == markHRule {
-			var subout bytes.Buffer
-			subout.Write(indent1)
-			for subout.Len() < width {
-				subout.WriteByte(line[1])
-			}
-			out.Write(subout.Bytes())
-			out.WriteByte(markLineBreak)
-			continue
-		}
-		lineLen := 0
-		start := true
-		for _, word := range bytes.Split(line, []byte{' '}) {
-			wordLen := len(word)
-			if wordLen == 0 {
-				continue
-			}
-			scan := word
-			for len(scan) > 1 {
-				i := bytes.IndexByte(scan, '\x1b')
-				if i == -1 {
-					break
-				}
-				j := bytes.IndexByte(scan[i+1:], 'm')
-				if j == -1 {
-					i++
-				} else {
-					j += 2
-					wordLen -= j
-					scan = scan[i+j:]
-				}
-			}
-			if start {
-				if out.Len() == 0 {
-					out.Write(indent1)
-					lineLen += len(indent1)
-				} else {
-					out.Write(indent2)
-					lineLen += len(indent2)
-				}
-				out.Write(word)
-				lineLen += wordLen
-				start = false
-			} else if lineLen+1+wordLen >= width {
-				out.WriteByte(markLineBreak)
-				out.Write(indent2)
-				out.Write(word)
-				lineLen = len(indent2) + wordLen
-			} else {
-				out.WriteByte(' ')
-				out.Write(word)
-				lineLen += 1 + wordLen
-			}
-		}
-		out.WriteByte(markLineBreak)
+	if smart && rend.smartPunctuation {
+		out.write(smartText(out.lastRune(), text))
+		return
 	}
-	return out.Bytes()
+	out.write(text)
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/gholt/brimtext"
+	"github.com/russross/blackfriday/v2"
 )
 
 func TestBasic(t *testing.T) {
@@ -94,7 +95,7 @@ Three: Four`
 		[]string{"One", "Two"},
 		[]string{"Three", "Four"},
 	}
-	expPos = 19
+	expPos = 20
 	if !metadataEqualForTesting(out, exp) {
 		t.Errorf("%#v != %#v", out, exp)
 	}
@@ -527,3 +528,42 @@ https://link | Two | Three
 		t.Errorf("%#v != %#v", out, exp)
 	}
 }
+
+func TestExtensions(t *testing.T) {
+	in := "# Head {#id}\n\nText[^1] at http://x.org\nbroken.\n\n[^1]: A note.\n\n    More.\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80}))
+	exp := "--[ Head {#id} ]--\n\n    Text[^1] at http://x.org broken.\n\n    [^1]: A note.\n\n    More.\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	opts := &Options{
+		Width:      80,
+		Extensions: DefaultExtensions | blackfriday.Footnotes | blackfriday.HeadingIDs | blackfriday.HardLineBreak,
+	}
+	exp = "--[ Head ]--\n\n    Text[1] at http://x.org\n    broken.\n\n    [1] A note.\n\n        More.\n"
+	for _, parser := range []Parser{ParserBlackfriday, ParserCommonMark} {
+		opts.Parser = parser
+		out = string(MarkdownToTextNoMetadata([]byte(in), opts))
+		if out != exp {
+			t.Errorf("%#v != %#v", out, exp)
+		}
+	}
+	in = "See http://x.org now."
+	opts = &Options{Width: 80, Color: true, Extensions: DefaultExtensions &^ blackfriday.Autolink}
+	out = string(MarkdownToTextNoMetadata([]byte(in), opts))
+	exp = "See http://x.org now.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	in = "See http://x.org ~~now~~.\n\n| a |\n|---|\n| 1 |\n"
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Extensions: NoExtensions}))
+	exp = "See http://x.org ~~now~~.\n\n| a | |---| | 1 |\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Extensions: NoExtensions | blackfriday.Tables}))
+	exp = "See http://x.org ~~now~~.\n\n+---+\n| a |\n+---+\n| 1 |\n+---+\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"os"
+	"strings"
+)
+
+// ColorMode indicates which colors the terminal supports.
+type ColorMode int
+
+const (
+	// ColorModeDefault leaves it to Options.Color whether there is color,
+	// with colors output as they are given; the default.
+	ColorModeDefault ColorMode = iota
+	// ColorModeNone outputs no color, as if Options.Color were not set.
+	ColorModeNone
+	// ColorMode16 outputs only the 16 ANSI colors, others being replaced
+	// with the closest of them.
+	ColorMode16
+	// ColorMode256 outputs only colors of the 256 color palette, 24-bit
+	// colors being replaced with the closest of them.
+	ColorMode256
+	// ColorModeTrueColor outputs colors as they are given, and 24-bit
+	// colors for ImageProtocolBlocks art.
+	ColorModeTrueColor
+	// ColorModeAuto uses DetectColorMode to choose one of the other modes;
+	// Render checks whether its writer is a terminal, and the functions
+	// returning the text whether os.Stdout is.
+	ColorModeAuto
+)
+
+// DetectColorMode guesses which colors the terminal supports based on
+// whether the output is a terminal, tty, and the environment variables
+// returned by getenv, which may be nil to use os.Getenv. NO_COLOR set to
+// anything disables color; otherwise CLICOLOR_FORCE set to anything but
+// "0" enables color even if the output is not a terminal. COLORTERM and
+// TERM then indicate how many colors there are; ColorModeNone is returned
+// for TERM "dumb" or unset.
+func DetectColorMode(getenv func(string) string, tty bool) ColorMode {
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	if getenv("NO_COLOR") != "" {
+		return ColorModeNone
+	}
+	force := getenv("CLICOLOR_FORCE")
+	forced := force != "" && force != "0"
+	if !tty && !forced {
+		return ColorModeNone
+	}
+	term := getenv("TERM")
+	switch colorTerm := getenv("COLORTERM"); {
+	case colorTerm == "truecolor", colorTerm == "24bit",
+		strings.HasSuffix(term, "-direct"):
+		return ColorModeTrueColor
+	case strings.Contains(term, "256color"):
+		return ColorMode256
+	case term == "", term == "dumb":
+		if forced {
+			return ColorMode16
+		}
+		return ColorModeNone
+	}
+	return ColorMode16
+}
+
+// isTerminal returns true if the file is a terminal, or at least a
+// character device such as one.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// ansi16RGB are the colors of the 16 ANSI colors, as xterm has them by
+// default; terminals vary.
+var ansi16RGB = [16][3]uint8{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0},
+	{0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0},
+	{92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// rgb returns the red, green and blue values of a color other than
+// ColorDefault, those of the 16 ANSI colors being xterm's.
+func (c Color) rgb() (uint8, uint8, uint8) {
+	i := int(c & colorPaletteMask)
+	switch c & colorKindMask {
+	case colorKind16:
+		v := ansi16RGB[i&15]
+		return v[0], v[1], v[2]
+	case colorKind256:
+		switch {
+		case i < 16:
+			v := ansi16RGB[i]
+			return v[0], v[1], v[2]
+		case i < 232:
+			levels := [6]uint8{0, 95, 135, 175, 215, 255}
+			i -= 16
+			return levels[i/36], levels[i/6%6], levels[i%6]
+		}
+		v := uint8(8 + (i-232)*10)
+		return v, v, v
+	}
+	v := c & colorValueMask
+	return uint8(v >> 16), uint8(v >> 8), uint8(v)
+}
+
+// quantize returns the closest color to c that mode supports.
+func (c Color) quantize(mode ColorMode) Color {
+	kind := c & colorKindMask
+	switch {
+	case c == ColorDefault, kind == colorKind16:
+		return c
+	case mode == ColorMode256:
+		if kind == colorKindRGB {
+			return PaletteColor(uint8(ansi256(c.rgb())))
+		}
+	case mode == ColorMode16:
+		if kind == colorKind256 && c&colorPaletteMask < 16 {
+			return ANSIColor(uint8(c & colorPaletteMask))
+		}
+		r, g, b := c.rgb()
+		best, bestDist := 0, -1
+		for i, v := range ansi16RGB {
+			d := sq(int(r)-int(v[0])) + sq(int(g)-int(v[1])) + sq(int(b)-int(v[2]))
+			if bestDist < 0 || d < bestDist {
+				best, bestDist = i, d
+			}
+		}
+		return ANSIColor(uint8(best))
+	}
+	return c
+}
+
+// quantize returns the style with its colors the closest that mode
+// supports.
+func (s Style) quantize(mode ColorMode) Style {
+	s.Foreground = s.Foreground.quantize(mode)
+	s.Background = s.Background.quantize(mode)
+	return s
+}
@@ -0,0 +1,90 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestDetectColorMode(t *testing.T) {
+	for _, c := range []struct {
+		env map[string]string
+		tty bool
+		exp ColorMode
+	}{
+		{map[string]string{"TERM": "xterm"}, true, ColorMode16},
+		{map[string]string{"TERM": "xterm"}, false, ColorModeNone},
+		{map[string]string{"TERM": "xterm-256color"}, true, ColorMode256},
+		{map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor"}, true, ColorModeTrueColor},
+		{map[string]string{"TERM": "xterm", "COLORTERM": "24bit"}, true, ColorModeTrueColor},
+		{map[string]string{"TERM": "xterm-direct"}, true, ColorModeTrueColor},
+		{map[string]string{"TERM": "dumb"}, true, ColorModeNone},
+		{map[string]string{}, true, ColorModeNone},
+		{map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1"}, true, ColorModeNone},
+		{map[string]string{"TERM": "xterm-256color", "NO_COLOR": "1", "CLICOLOR_FORCE": "1"}, true, ColorModeNone},
+		{map[string]string{"TERM": "xterm-256color", "CLICOLOR_FORCE": "1"}, false, ColorMode256},
+		{map[string]string{"CLICOLOR_FORCE": "1"}, false, ColorMode16},
+		{map[string]string{"TERM": "xterm", "CLICOLOR_FORCE": "0"}, false, ColorModeNone},
+	} {
+		env := c.env
+		out := DetectColorMode(func(k string) string { return env[k] }, c.tty)
+		if out != c.exp {
+			t.Errorf("%#v %#v: %#v != %#v", c.env, c.tty, out, c.exp)
+		}
+	}
+}
+
+func TestColorQuantize(t *testing.T) {
+	for _, c := range []struct {
+		in   Color
+		mode ColorMode
+		exp  Color
+	}{
+		{RGBColor(255, 135, 0), ColorModeTrueColor, RGBColor(255, 135, 0)},
+		{RGBColor(255, 135, 0), ColorModeDefault, RGBColor(255, 135, 0)},
+		{RGBColor(255, 135, 0), ColorMode256, PaletteColor(208)},
+		{RGBColor(128, 128, 128), ColorMode256, PaletteColor(244)},
+		{RGBColor(250, 10, 10), ColorMode16, ColorBrightRed},
+		{RGBColor(0, 0, 230), ColorMode16, ColorBlue},
+		{PaletteColor(208), ColorMode256, PaletteColor(208)},
+		{PaletteColor(46), ColorMode16, ColorBrightGreen},
+		{PaletteColor(3), ColorMode16, ColorYellow},
+		{PaletteColor(240), ColorMode16, ColorBrightBlack},
+		{ColorCyan, ColorMode16, ColorCyan},
+		{ColorDefault, ColorMode16, ColorDefault},
+	} {
+		out := c.in.quantize(c.mode)
+		if out != c.exp {
+			t.Errorf("%#v in %#v: %#v != %#v", c.in, c.mode, out, c.exp)
+		}
+	}
+}
+
+func TestColorMode(t *testing.T) {
+	in := "# Head\n"
+	styles := map[Element]Style{ElementHeader: {Foreground: RGBColor(255, 135, 0)}}
+	for _, c := range []struct {
+		opts Options
+		exp  string
+	}{
+		{Options{Color: true}, "--[ \x1b[38;2;255;135;0mHead\x1b[0m ]--\n\n"},
+		{Options{ColorMode: ColorModeTrueColor}, "--[ \x1b[38;2;255;135;0mHead\x1b[0m ]--\n\n"},
+		{Options{ColorMode: ColorMode256}, "--[ \x1b[38;5;208mHead\x1b[0m ]--\n\n"},
+		{Options{ColorMode: ColorMode16}, "--[ \x1b[33mHead\x1b[0m ]--\n\n"},
+		{Options{Color: true, ColorMode: ColorModeNone}, "--[ Head ]--\n\n"},
+		{Options{Color: true, ColorMode: ColorModeAuto, Getenv: func(string) string { return "" }}, "--[ Head ]--\n\n"},
+		{Options{ColorMode: ColorModeAuto, Getenv: func(k string) string {
+			return map[string]string{"CLICOLOR_FORCE": "1", "TERM": "xterm-256color"}[k]
+		}}, "--[ \x1b[38;5;208mHead\x1b[0m ]--\n\n"},
+	} {
+		opts := c.opts
+		opts.Width = 80
+		opts.Styles = styles
+		out := string(MarkdownToTextNoMetadata([]byte(in), &opts))
+		if out != c.exp {
+			t.Errorf("%#v != %#v", out, c.exp)
+		}
+	}
+}
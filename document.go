@@ -0,0 +1,316 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+
+	"github.com/gholt/brimtext"
+)
+
+// Document is rendered Markdown before it is laid out as lines of text:
+// blocks of styled text, indented groups of blocks, rules, and tables. It
+// may be inspected or changed, to drop sections or restyle spans for
+// example, before Layout produces the text.
+//
+// A header is a BlockGroup of its own, followed by a BlockGroup holding the
+// content up to the next header of the same or a higher level, so dropping
+// the two drops the section.
+type Document struct {
+	Blocks []*Block
+}
+
+// BlockKind indicates what a Block is.
+type BlockKind int
+
+const (
+	// BlockText is Spans wrapped into lines.
+	BlockText BlockKind = iota
+	// BlockGroup is Blocks indented by Indent1 on their first line and
+	// Indent2 on any others, in addition to the enclosing indentation.
+	BlockGroup
+	// BlockRule is a line filled with the Rule character.
+	BlockRule
+	// BlockTable is a Table, aligned to fit the width.
+	BlockTable
+)
+
+// Block is a part of a Document laid out on lines of its own.
+type Block struct {
+	Kind BlockKind
+	// Spans are the text of a BlockText. Its last line is ended anyway, so
+	// a final Break leaves a blank line and a block of no spans is a blank
+	// line.
+	Spans []Span
+	// Indent1 and Indent2 are the indentation of a BlockGroup.
+	Indent1 string
+	Indent2 string
+	// Blocks are those in a BlockGroup.
+	Blocks []*Block
+	// Rule is the character of a BlockRule.
+	Rule byte
+	// Table is that of a BlockTable.
+	Table *Table
+}
+
+// Span is a run of text with the same styling.
+type Span struct {
+	Text string
+	// Styles are the elements the text is part of, outermost first.
+	Styles []Element
+	// NoWrap set true keeps lines from being wrapped at the spaces and tabs
+	// in Text, though they are at its newlines.
+	NoWrap bool
+	// Raw set true outputs Text as it is, counting it as a single
+	// character; inline images are raw.
+	Raw bool
+	// Break set true ends the line rather than adding Text.
+	Break bool
+}
+
+// Element is a kind of Markdown element text is styled as. Each is colored
+// as its Options.Styles entry or the Options color of the same name says
+// or, without color, some are delimited as they are in Markdown.
+type Element int
+
+const (
+	// ElementHeader is header text.
+	ElementHeader Element = iota
+	// ElementLink is a link, including its destination.
+	ElementLink
+	// ElementImage is an image shown as its alt text and destination.
+	ElementImage
+	// ElementCodeSpan is inline code, delimited by '"' without color.
+	ElementCodeSpan
+	// ElementBlockCode is a line of a code block.
+	ElementBlockCode
+	// ElementStrikethrough is struck out text, delimited by "~~" without
+	// color.
+	ElementStrikethrough
+	// ElementEmphasis is emphasized text, delimited by "*" without color.
+	ElementEmphasis
+	// ElementDoubleEmphasis is strongly emphasized text, delimited by "**"
+	// without color.
+	ElementDoubleEmphasis
+	// ElementTripleEmphasis is text with both emphases, delimited by "***"
+	// without color.
+	ElementTripleEmphasis
+	// ElementHeader1 through ElementHeader6 are header text of each level,
+	// within ElementHeader.
+	ElementHeader1
+	ElementHeader2
+	ElementHeader3
+	ElementHeader4
+	ElementHeader5
+	ElementHeader6
+	// ElementBlockQuote is the text of a block quote.
+	ElementBlockQuote
+	// ElementTableHeader is the text of a table's header cells.
+	ElementTableHeader
+	// ElementTableBorder is the borders of a table, which are not part of
+	// the Document's text.
+	ElementTableBorder
+	// ElementCodeKeyword, ElementCodeString, ElementCodeComment and
+	// ElementCodeNumber are the tokens of a code block, within
+	// ElementBlockCode, for a Renderer that highlights code to style; the
+	// default rendering leaves code blocks unhighlighted, and the built-in
+	// themes leave these unstyled.
+	ElementCodeKeyword
+	ElementCodeString
+	ElementCodeComment
+	ElementCodeNumber
+	// ElementMetadataName is the name of a metadata item, within
+	// ElementHeader.
+	ElementMetadataName
+	// ElementMetadataValue is the value of a metadata item.
+	ElementMetadataValue
+)
+
+// headerElement returns the element of header text of the level.
+func headerElement(level int) Element {
+	if level < 1 {
+		level = 1
+	} else if level > 6 {
+		level = 6
+	}
+	return ElementHeader1 + Element(level-1)
+}
+
+// Table is the content of a Markdown table.
+type Table struct {
+	// Header rows are separated from the Body rows by a line. A header row
+	// whose first cell is "omit" is left out, for tables without headers.
+	Header [][]TableCell
+	Body   [][]TableCell
+	// Alignments are those of the columns, so its length is the number of
+	// columns; cells beyond are left out.
+	Alignments []brimtext.Alignment
+}
+
+// TableCell is the text of a table cell; it is wrapped to fit the column.
+type TableCell struct {
+	Spans []Span
+}
+
+// MarkdownToDocument parses the markdown, as MarkdownToTextNoMetadata does,
+// returning the Document that Layout would produce the text from.
+func MarkdownToDocument(markdown []byte, opts *Options) *Document {
+	pieces, _, _ := markdownToPieces(markdown, nil, resolveOpts(opts), nil)
+	return &Document{Blocks: newBlocks(pieces, nil)}
+}
+
+// Layout returns the text of the document, wrapped to opts.Width and
+// colored as opts indicate. If opts is nil the defaults will be used.
+func Layout(doc *Document, opts *Options) []byte {
+	opts = resolveOpts(opts)
+	var out bytes.Buffer
+	newLayout(opts).blocks(&out, doc.Blocks, opts.Indent1, opts.Indent2)
+	return out.Bytes()
+}
+
+// newBlocks returns the pieces as blocks, with pieceGroup to pieceEnd as a
+// BlockGroup and lines holding just a rule or table as blocks of their own.
+// The pieces continue with styles, if not nil, started.
+func newBlocks(pieces []piece, styles *[]Element) []*Block {
+	if styles == nil {
+		styles = &[]Element{}
+	}
+	var blocks []*Block
+	var run []piece
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		styled := true
+		for _, p := range run {
+			if p.kind != pieceStyle && p.kind != pieceStyleEnd {
+				styled = false
+			}
+		}
+		if styled {
+			// Styles starting or ending around groups are not text.
+			appendSpans(nil, run, styles)
+			run = nil
+			return
+		}
+		// As with the text before a group, the last line break just ends
+		// the last line, even if styles end after it.
+		last := len(run) - 1
+		for last > 0 && (run[last].kind == pieceStyle || run[last].kind == pieceStyleEnd) {
+			last--
+		}
+		if run[last].kind == pieceBreak {
+			run = append(run[:last:last], run[last+1:]...)
+		}
+		var line []piece
+		var spans []Span
+		text := false
+		for i := 0; i <= len(run); i++ {
+			if i < len(run) && run[i].kind != pieceBreak {
+				line = append(line, run[i])
+				continue
+			}
+			if p, ok := alone(line); ok && (p.kind == pieceRule || p.kind == pieceTable) {
+				if text {
+					blocks = append(blocks, &Block{Kind: BlockText, Spans: spans[:len(spans)-1]})
+				}
+				if p.kind == pieceRule {
+					blocks = append(blocks, &Block{Kind: BlockRule, Rule: p.text[0]})
+				} else {
+					blocks = append(blocks, &Block{Kind: BlockTable, Table: p.table})
+				}
+				appendSpans(nil, line, styles)
+				spans = nil
+				text = false
+			} else {
+				spans = appendSpans(spans, line, styles)
+				text = true
+				if i < len(run) {
+					spans = append(spans, Span{Break: true, Styles: *styles})
+				}
+			}
+			line = nil
+		}
+		if text {
+			blocks = append(blocks, &Block{Kind: BlockText, Spans: spans})
+		}
+		run = nil
+	}
+	for len(pieces) > 0 {
+		p := pieces[0]
+		pieces = pieces[1:]
+		if p.kind != pieceGroup {
+			run = append(run, p)
+			continue
+		}
+		flush()
+		nested := 1
+		j := 0
+		for ; j < len(pieces); j++ {
+			if pieces[j].kind == pieceGroup {
+				nested++
+			} else if pieces[j].kind == pieceEnd {
+				nested--
+				if nested == 0 {
+					break
+				}
+			}
+		}
+		blocks = append(blocks, &Block{
+			Kind:    BlockGroup,
+			Indent1: string(p.indent1),
+			Indent2: string(p.indent2),
+			Blocks:  newBlocks(pieces[:j], styles),
+		})
+		if j < len(pieces) {
+			j++
+		}
+		pieces = pieces[j:]
+	}
+	flush()
+	return blocks
+}
+
+// alone returns the only piece of the line other than any styles starting
+// or ending around it, and whether there is just the one.
+func alone(line []piece) (piece, bool) {
+	var only piece
+	n := 0
+	for _, p := range line {
+		if p.kind != pieceStyle && p.kind != pieceStyleEnd {
+			only = p
+			n++
+		}
+	}
+	return only, n == 1
+}
+
+// appendSpans appends the text of the pieces as spans, with styles the
+// elements started but not yet ended.
+func appendSpans(spans []Span, pieces []piece, styles *[]Element) []Span {
+	for _, p := range pieces {
+		switch p.kind {
+		case pieceText:
+			spans = append(spans, Span{Text: string(p.text), Styles: *styles, NoWrap: p.nowrap})
+		case pieceRule:
+			spans = append(spans, Span{Text: string(p.text), Styles: *styles, NoWrap: true})
+		case pieceRaw:
+			spans = append(spans, Span{Text: string(p.text), Styles: *styles, Raw: true})
+		case pieceBreak:
+			spans = append(spans, Span{Break: true, Styles: *styles})
+		case pieceStyle:
+			*styles = append((*styles)[:len(*styles):len(*styles)], p.element)
+		case pieceStyleEnd:
+			// An end without a start, as from stray HTML, is dropped.
+			for i := len(*styles) - 1; i >= 0; i-- {
+				if (*styles)[i] == p.element {
+					*styles = append((*styles)[:i:i], (*styles)[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return spans
+}
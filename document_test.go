@@ -0,0 +1,99 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestLayoutMatchesMarkdownToText(t *testing.T) {
+	in := []byte(`# One
+
+Some *text* here, with a [link](http://example.com) that wraps.
+
+* a
+* b
+
+---
+
+| a | b |
+|---|--:|
+| 1 | 2 |
+
+    code
+`)
+	for _, opts := range []*Options{
+		{Width: 40},
+		{Width: 30, Color: true},
+		{Width: 40, Indent1: []byte("> "), Indent2: []byte("  ")},
+	} {
+		out := string(Layout(MarkdownToDocument(in, opts), opts))
+		exp := string(MarkdownToTextNoMetadata(in, opts))
+		if out != exp {
+			t.Errorf("%#v != %#v", out, exp)
+		}
+	}
+}
+
+func TestDocumentDropSection(t *testing.T) {
+	in := []byte("# One\n\nFirst.\n\n# Two\n\nSecond.\n\n# Three\n\nThird.\n")
+	opts := &Options{Width: 40}
+	doc := MarkdownToDocument(in, opts)
+	var blocks []*Block
+	for i := 0; i < len(doc.Blocks); i++ {
+		b := doc.Blocks[i]
+		if b.Kind == BlockGroup && len(b.Blocks) > 0 && len(b.Blocks[0].Spans) > 0 && b.Blocks[0].Spans[0].Text == "Two" {
+			// Skip the header and the section following it.
+			i++
+			continue
+		}
+		blocks = append(blocks, b)
+	}
+	doc.Blocks = blocks
+	out := string(Layout(doc, opts))
+	exp := "--[ One ]--\n\n    First.\n\n--[ Three ]--\n\n    Third.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestDocumentRestyle(t *testing.T) {
+	in := []byte("Some *text* and `code`.\n")
+	opts := &Options{Width: 40}
+	doc := MarkdownToDocument(in, opts)
+	if len(doc.Blocks) != 1 || doc.Blocks[0].Kind != BlockText {
+		t.Fatalf("%#v", doc.Blocks)
+	}
+	spans := doc.Blocks[0].Spans
+	for i := range spans {
+		for j, e := range spans[i].Styles {
+			if e == ElementEmphasis {
+				spans[i].Styles = append([]Element(nil), spans[i].Styles...)
+				spans[i].Styles[j] = ElementDoubleEmphasis
+			}
+		}
+	}
+	out := string(Layout(doc, opts))
+	exp := "Some **text** and \"code\".\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestDocumentTable(t *testing.T) {
+	in := []byte("| a | b |\n|---|---|\n| 1 | *2* |\n")
+	doc := MarkdownToDocument(in, &Options{Width: 40})
+	if len(doc.Blocks) != 1 || doc.Blocks[0].Kind != BlockTable {
+		t.Fatalf("%#v", doc.Blocks)
+	}
+	table := doc.Blocks[0].Table
+	if len(table.Header) != 1 || len(table.Body) != 1 || len(table.Alignments) != 2 {
+		t.Fatalf("%#v", table)
+	}
+	cell := table.Body[0][1]
+	if len(cell.Spans) != 1 || cell.Spans[0].Text != "2" || len(cell.Spans[0].Styles) != 1 || cell.Spans[0].Styles[0] != ElementEmphasis {
+		t.Errorf("%#v", cell)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"html"
+	"unicode/utf8"
+)
+
+// asciiTransliterations maps non-ASCII runes to reasonable ASCII
+// approximations; see toASCII.
+var asciiTransliterations = map[rune]string{
+	'\u00a0': " ", '¡': "!", '¢': "c", '£': "GBP",
+	'¥': "JPY", '¦': "|", '§': "S", '¨': "\"",
+	'©': "(c)", 'ª': "a", '«': "<<", '¬': "!",
+	'\u00ad': "", '®': "(R)", '¯': "-", '°': "deg",
+	'±': "+/-", '²': "^2", '³': "^3", '´': "'",
+	'µ': "u", '¶': "P", '·': ".", '¸': ",",
+	'¹': "^1", 'º': "o", '»': ">>", '¼': "1/4",
+	'½': "1/2", '¾': "3/4", '¿': "?", 'Æ': "AE",
+	'Ç': "C", 'Ð': "D", 'Ñ': "N", '×': "x",
+	'Ø': "O", 'Ý': "Y", 'Þ': "TH", 'ß': "ss",
+	'æ': "ae", 'ç': "c", 'ð': "d", 'ñ': "n",
+	'÷': "/", 'ø': "o", 'ý': "y", 'þ': "th",
+	'ÿ': "y", 'Œ': "OE", 'œ': "oe", 'Š': "S",
+	'š': "s", 'Ÿ': "Y", 'Ž': "Z", 'ž': "z",
+	'ƒ': "f", 'ˆ': "^", '˜': "~", '\u2002': " ",
+	'\u2003': " ", '\u2009': " ", '\u200b': "", '\u200c': "",
+	'\u200d': "", '‐': "-", '‑': "-", '‒': "-",
+	'–': "-", '—': "--", '―': "--", '‘': "'",
+	'’': "'", '‚': ",", '“': "\"", '”': "\"",
+	'„': ",,", '†': "+", '‡': "++", '•': "*",
+	'…': "...", '‰': "0/00", '′': "'", '″': "\"",
+	'‹': "<", '›': ">", '⁄': "/", '€': "EUR",
+	'™': "(TM)", '←': "<-", '→': "->", '↔': "<->",
+	'⇐': "<=", '⇒': "=>", '⇔': "<=>", '−': "-",
+	'∗': "*", '∞': "inf", '≈': "~=", '≠': "!=",
+	'≤': "<=", '≥': ">=", '⅓': "1/3", '⅔': "2/3",
+	'⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8",
+}
+
+// asciiLatin1Letters holds the base letters for the accented letters U+00C0
+// through U+00FF; '-' entries are handled by asciiTransliterations.
+const asciiLatin1Letters = "AAAAAA-CEEEEIIII-NOOOOO-OUUUUY--aaaaaa-ceeeeiiii-nooooo-ouuuuy-y"
+
+// toASCII returns text with every non-ASCII rune replaced by an ASCII
+// approximation, or "?" if there isn't a reasonable one.
+func toASCII(text []byte) []byte {
+	i := 0
+	for i < len(text) && text[i] < utf8.RuneSelf {
+		i++
+	}
+	if i == len(text) {
+		return text
+	}
+	out := make([]byte, i, len(text))
+	copy(out, text)
+	for i < len(text) {
+		if text[i] < utf8.RuneSelf {
+			out = append(out, text[i])
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(text[i:])
+		i += size
+		if s, ok := asciiTransliterations[r]; ok {
+			out = append(out, s...)
+		} else if r >= 0xc0 && r <= 0xff && asciiLatin1Letters[r-0xc0] != '-' {
+			out = append(out, asciiLatin1Letters[r-0xc0])
+		} else {
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// writeEntities writes text with any HTML entities replaced by the
+// characters they represent, with non-breaking spaces kept from wrapping.
+// Unknown entities are left unchanged. If nowrap is set, none of the text
+// is wrapped at its spaces.
+func (rend *renderer) writeEntities(out *textBuffer, text []byte, nowrap bool) {
+	write := out.write
+	if nowrap {
+		write = out.writeNoWrap
+	}
+	if bytes.IndexByte(text, '&') == -1 {
+		write(text)
+		return
+	}
+	decoded := []byte(html.UnescapeString(string(text)))
+	if bytes.Equal(decoded, text) {
+		write(text)
+		return
+	}
+	for i, part := range bytes.Split(decoded, []byte("\u00a0")) {
+		if i > 0 {
+			out.writeNoWrap([]byte(" "))
+		}
+		if rend.ascii {
+			part = toASCII(part)
+		}
+		write(part)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestEntity(t *testing.T) {
+	in := "&copy; 2019 &mdash; it&#8217;s&nbsp;here &#x2192; &amp; &bogus; &lt;done&gt;"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80}))
+	exp := "© 2019 — it’s here → & &bogus; <done>\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, ASCII: true}))
+	exp = "(c) 2019 -- it's here -> & &bogus; <done>\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	// The non-breaking space keeps "a b" together when wrapping.
+	in = "one two three four&nbsp;five"
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 20}))
+	exp = "one two three\nfour five\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestToASCII(t *testing.T) {
+	in := "Crème brûlée – “naïve” Æsir ½ 日本"
+	out := string(toASCII([]byte(in)))
+	exp := "Creme brulee - \"naive\" AEsir 1/2 ??"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
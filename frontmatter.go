@@ -0,0 +1,370 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// FrontMatter is structured metadata from the start of a Markdown document,
+// such as YAML between "---" lines. The embedded FrontMatterMap gives typed
+// access to its values.
+type FrontMatter struct {
+	*FrontMatterMap
+	// Format is the name of the FrontMatterParser that recognized the front
+	// matter, such as "yaml", "toml" or "json".
+	Format string
+}
+
+// FrontMatterMap is a mapping parsed from front matter, keeping its keys in
+// their original order. Values are *FrontMatterMap for nested mappings,
+// []interface{} for lists, and string, int64, float64, bool or nil for
+// scalars.
+//
+// The accessor methods take a path of keys to descend through nested
+// mappings, with list elements addressed by their decimal index; for
+// example m.String("authors", "0", "name").
+type FrontMatterMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// NewFrontMatterMap returns an empty mapping, for use by FrontMatterParser
+// implementations.
+func NewFrontMatterMap() *FrontMatterMap {
+	return &FrontMatterMap{values: make(map[string]interface{})}
+}
+
+// Set sets the value for the key, appending the key if it is new. The value
+// should be one of the types described for FrontMatterMap.
+func (m *FrontMatterMap) Set(key string, value interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// Keys returns the keys of the mapping in their original order.
+func (m *FrontMatterMap) Keys() []string {
+	return append([]string(nil), m.keys...)
+}
+
+// Get returns the value at the path and whether it exists.
+func (m *FrontMatterMap) Get(path ...string) (interface{}, bool) {
+	var v interface{} = m
+	for _, key := range path {
+		switch c := v.(type) {
+		case *FrontMatterMap:
+			var ok bool
+			if v, ok = c.values[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, false
+			}
+			v = c[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// String returns the scalar at the path formatted as a string; false is
+// returned if there is no such scalar.
+func (m *FrontMatterMap) String(path ...string) (string, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return "", false
+	}
+	return formatFrontMatterScalar(v)
+}
+
+// Strings returns the scalars of the list at the path formatted as strings;
+// a single scalar is returned as a one item list. False is returned if the
+// value does not exist or contains anything other than scalars.
+func (m *FrontMatterMap) Strings(path ...string) ([]string, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return nil, false
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		s, ok := formatFrontMatterScalar(v)
+		if !ok {
+			return nil, false
+		}
+		return []string{s}, true
+	}
+	ss := make([]string, 0, len(list))
+	for _, item := range list {
+		s, ok := formatFrontMatterScalar(item)
+		if !ok {
+			return nil, false
+		}
+		ss = append(ss, s)
+	}
+	return ss, true
+}
+
+// Int returns the integer at the path; strings holding integers are
+// converted.
+func (m *FrontMatterMap) Int(path ...string) (int64, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return 0, false
+	}
+	switch t := v.(type) {
+	case int64:
+		return t, true
+	case float64:
+		if t == float64(int64(t)) {
+			return int64(t), true
+		}
+	case string:
+		if i, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Float returns the number at the path; strings holding numbers are
+// converted.
+func (m *FrontMatterMap) Float(path ...string) (float64, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return 0, false
+	}
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int64:
+		return float64(t), true
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
+
+// Bool returns the boolean at the path; strings holding "true" or "false"
+// and the like are converted.
+func (m *FrontMatterMap) Bool(path ...string) (bool, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return false, false
+	}
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case string:
+		if b, err := strconv.ParseBool(t); err == nil {
+			return b, true
+		}
+	}
+	return false, false
+}
+
+// Map returns the nested mapping at the path.
+func (m *FrontMatterMap) Map(path ...string) (*FrontMatterMap, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return nil, false
+	}
+	nested, ok := v.(*FrontMatterMap)
+	return nested, ok
+}
+
+// List returns the list at the path.
+func (m *FrontMatterMap) List(path ...string) ([]interface{}, bool) {
+	v, ok := m.Get(path...)
+	if !ok {
+		return nil, false
+	}
+	list, ok := v.([]interface{})
+	return list, ok
+}
+
+// items flattens the mapping into [][]string metadata form: nested mapping
+// keys are joined with ".", lists of scalars become repeated items, and
+// other list elements are addressed by index.
+func (m *FrontMatterMap) items(prefix string) [][]string {
+	var items [][]string
+	for _, key := range m.keys {
+		items = appendFrontMatterItems(items, prefix+key, m.values[key])
+	}
+	return items
+}
+
+func appendFrontMatterItems(items [][]string, name string, v interface{}) [][]string {
+	switch t := v.(type) {
+	case *FrontMatterMap:
+		return append(items, t.items(name+".")...)
+	case []interface{}:
+		for i, item := range t {
+			if s, ok := formatFrontMatterScalar(item); ok {
+				items = append(items, []string{name, s})
+			} else {
+				items = appendFrontMatterItems(items, fmt.Sprintf("%s.%d", name, i), item)
+			}
+		}
+		return items
+	}
+	s, _ := formatFrontMatterScalar(v)
+	return append(items, []string{name, s})
+}
+
+// formatFrontMatterScalar returns the scalar v as a string, or false if v
+// is not a scalar.
+func formatFrontMatterScalar(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case nil:
+		return "", true
+	case string:
+		return t, true
+	case bool:
+		return strconv.FormatBool(t), true
+	case int64:
+		return strconv.FormatInt(t, 10), true
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// FrontMatterParser recognizes and parses one format of front matter.
+type FrontMatterParser interface {
+	// Format returns the name of the format, such as "yaml".
+	Format() string
+	// Split returns the front matter text at the start of markdown and the
+	// position of the rest of the markdown, or false if markdown does not
+	// start with front matter in this format.
+	Split(markdown []byte) ([]byte, int, bool)
+	// Parse parses the front matter text returned by Split.
+	Parse(text []byte) (*FrontMatterMap, error)
+}
+
+var frontMatterParsers = []FrontMatterParser{
+	yamlFrontMatter{},
+	tomlFrontMatter{},
+	jsonFrontMatter{},
+}
+
+// RegisterFrontMatterParser adds a parser for another front matter format.
+// Parsers are tried most recently registered first, ahead of the built in
+// YAML, TOML and JSON parsers. It is not safe to call concurrently with
+// parsing.
+func RegisterFrontMatterParser(p FrontMatterParser) {
+	frontMatterParsers = append([]FrontMatterParser{p}, frontMatterParsers...)
+}
+
+// MarkdownFrontMatter parses just the front matter from the start of the
+// markdown, returning it and the position of the rest of the markdown, or
+// nil and 0 if there is no front matter or it could not be parsed.
+//
+// YAML front matter, as used by many static site generators, starts with a
+// "---" line and ends with a "---" or "..." line. TOML front matter, as used
+// by Hugo, is between "+++" lines. JSON front matter is an object starting
+// at the very first byte and ending at the end of a line. Other formats may
+// be added with RegisterFrontMatterParser.
+func MarkdownFrontMatter(markdown []byte) (*FrontMatter, int) {
+	fm, pos, err := parseFrontMatter(markdown)
+	if err != nil || fm == nil {
+		return nil, 0
+	}
+	return fm, pos
+}
+
+// parseFrontMatter returns nil and no error if markdown does not start with
+// front matter, and an error if it does but the front matter is malformed.
+func parseFrontMatter(markdown []byte) (*FrontMatter, int, error) {
+	for _, p := range frontMatterParsers {
+		text, pos, ok := p.Split(markdown)
+		if !ok {
+			continue
+		}
+		m, err := p.Parse(text)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &FrontMatter{FrontMatterMap: m, Format: p.Format()}, pos, nil
+	}
+	return nil, 0, nil
+}
+
+// splitDelimitedFrontMatter splits front matter that starts with an open
+// line and ends with one of the close lines.
+func splitDelimitedFrontMatter(markdown []byte, open string, close ...string) ([]byte, int, bool) {
+	first, pos := nextLine(markdown, 0)
+	if string(first) != open {
+		return nil, 0, false
+	}
+	start := pos
+	for pos < len(markdown) {
+		lineStart := pos
+		var line []byte
+		line, pos = nextLine(markdown, pos)
+		for _, c := range close {
+			if string(line) == c {
+				return markdown[start:lineStart], pos, true
+			}
+		}
+	}
+	return nil, 0, false
+}
+
+type yamlFrontMatter struct{}
+
+func (yamlFrontMatter) Format() string {
+	return "yaml"
+}
+
+// Split only finds front matter that is blank or starts with a "key:" line,
+// as "---" lines are also thematic breaks and may well be one.
+func (yamlFrontMatter) Split(markdown []byte) ([]byte, int, bool) {
+	text, pos, ok := splitDelimitedFrontMatter(markdown, "---", "---", "...")
+	if !ok || !startsYAMLMapping(string(text)) {
+		return nil, 0, false
+	}
+	return text, pos, true
+}
+
+func (yamlFrontMatter) Parse(text []byte) (*FrontMatterMap, error) {
+	return parseYAML(string(text))
+}
+
+type tomlFrontMatter struct{}
+
+func (tomlFrontMatter) Format() string {
+	return "toml"
+}
+
+func (tomlFrontMatter) Split(markdown []byte) ([]byte, int, bool) {
+	return splitDelimitedFrontMatter(markdown, "+++", "+++")
+}
+
+func (tomlFrontMatter) Parse(text []byte) (*FrontMatterMap, error) {
+	return parseTOML(string(text))
+}
+
+// nextLine returns the line starting at pos, without its line ending or
+// trailing spaces, and the position of the following line.
+func nextLine(markdown []byte, pos int) ([]byte, int) {
+	end := bytes.IndexByte(markdown[pos:], '\n')
+	next := len(markdown)
+	if end == -1 {
+		end = len(markdown)
+	} else {
+		end += pos
+		next = end + 1
+	}
+	return bytes.TrimRight(markdown[pos:end], " \t\r"), next
+}
@@ -0,0 +1,226 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testYAMLFrontMatter = `---
+title: "Front: Matter"   # a comment
+draft: false
+weight: 10
+ratio: 0.5
+tags: [go, "mark down", text]
+author:
+  name: Someone
+  email: someone@example.com
+aliases:
+- /old
+- /older
+people:
+  - name: A
+    role: writer
+  - name: B
+description: >
+  Folded text
+  on two lines.
+notes: |
+  Literal
+  lines.
+empty:
+---
+
+# Body
+`
+
+func TestFrontMatterYAML(t *testing.T) {
+	fm, pos := MarkdownFrontMatter([]byte(testYAMLFrontMatter))
+	if fm == nil {
+		t.Fatal("no front matter")
+	}
+	if testYAMLFrontMatter[pos:] != "\n# Body\n" {
+		t.Errorf("%#v", testYAMLFrontMatter[pos:])
+	}
+	if s, ok := fm.String("title"); !ok || s != "Front: Matter" {
+		t.Errorf("%#v %v", s, ok)
+	}
+	if b, ok := fm.Bool("draft"); !ok || b {
+		t.Errorf("%#v %v", b, ok)
+	}
+	if i, ok := fm.Int("weight"); !ok || i != 10 {
+		t.Errorf("%#v %v", i, ok)
+	}
+	if f, ok := fm.Float("ratio"); !ok || f != 0.5 {
+		t.Errorf("%#v %v", f, ok)
+	}
+	if ss, ok := fm.Strings("tags"); !ok || !reflect.DeepEqual(ss, []string{"go", "mark down", "text"}) {
+		t.Errorf("%#v %v", ss, ok)
+	}
+	if s, ok := fm.String("author", "email"); !ok || s != "someone@example.com" {
+		t.Errorf("%#v %v", s, ok)
+	}
+	if s, ok := fm.String("people", "1", "name"); !ok || s != "B" {
+		t.Errorf("%#v %v", s, ok)
+	}
+	if s, ok := fm.String("description"); !ok || s != "Folded text on two lines.\n" {
+		t.Errorf("%#v %v", s, ok)
+	}
+	if s, ok := fm.String("notes"); !ok || s != "Literal\nlines.\n" {
+		t.Errorf("%#v %v", s, ok)
+	}
+	if v, ok := fm.Get("empty"); !ok || v != nil {
+		t.Errorf("%#v %v", v, ok)
+	}
+	if _, ok := fm.String("author"); ok {
+		t.Error("expected a mapping not to be a string")
+	}
+	if _, ok := fm.Get("people", "2"); ok {
+		t.Error("expected out of range index to be missing")
+	}
+	exp := []string{"title", "draft", "weight", "ratio", "tags", "author", "aliases", "people", "description", "notes", "empty"}
+	if keys := fm.Keys(); !reflect.DeepEqual(keys, exp) {
+		t.Errorf("%#v != %#v", keys, exp)
+	}
+}
+
+func TestMetadataYAMLFrontMatter(t *testing.T) {
+	out, pos := MarkdownMetadata([]byte(testYAMLFrontMatter))
+	exp := [][]string{
+		{"title", "Front: Matter"},
+		{"draft", "false"},
+		{"weight", "10"},
+		{"ratio", "0.5"},
+		{"tags", "go"},
+		{"tags", "mark down"},
+		{"tags", "text"},
+		{"author.name", "Someone"},
+		{"author.email", "someone@example.com"},
+		{"aliases", "/old"},
+		{"aliases", "/older"},
+		{"people.0.name", "A"},
+		{"people.0.role", "writer"},
+		{"people.1.name", "B"},
+		{"description", "Folded text on two lines.\n"},
+		{"notes", "Literal\nlines.\n"},
+		{"empty", ""},
+	}
+	if !metadataEqualForTesting(out, exp) {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	if testYAMLFrontMatter[pos:] != "\n# Body\n" {
+		t.Errorf("%#v", testYAMLFrontMatter[pos:])
+	}
+	// Without a closing line, it's just a horizontal rule.
+	in := "---\ntitle: x\n\nText\n"
+	out, pos = MarkdownMetadata([]byte(in))
+	if len(out) != 0 || pos != 0 {
+		t.Errorf("%#v %d", out, pos)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, in := range []string{
+		"a: [1, 2",
+		"a: b\n  c: d",
+		"- just\n- a list",
+		"a: \"unclosed",
+		"a: b\nplain text",
+	} {
+		if m, err := parseYAML(in); err == nil {
+			t.Errorf("%#v: expected error, got %#v", in, m)
+		}
+	}
+}
+
+func TestFrontMatterFormats(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		format string
+	}{
+		{"---\ntitle: T\n---\nBody\n", "yaml"},
+		{"+++\ntitle = \"T\"\n+++\nBody\n", "toml"},
+		{"{\n  \"title\": \"T\"\n}\nBody\n", "json"},
+		{"{\"title\": \"T\"}  \nBody\n", "json"},
+	} {
+		fm, pos := MarkdownFrontMatter([]byte(c.in))
+		if fm == nil {
+			t.Errorf("%#v: no front matter", c.in)
+			continue
+		}
+		if fm.Format != c.format {
+			t.Errorf("%#v: %#v != %#v", c.in, fm.Format, c.format)
+		}
+		if s, ok := fm.String("title"); !ok || s != "T" {
+			t.Errorf("%#v: %#v %v", c.in, s, ok)
+		}
+		if c.in[pos:] != "Body\n" {
+			t.Errorf("%#v: %#v", c.in, c.in[pos:])
+		}
+	}
+	for _, in := range []string{
+		"+++\ntitle = \"T\"\n\nBody\n",
+		"{\"title\": \"T\"} Body\n",
+		"{not json}\n",
+		"[1, 2]\n",
+		" {\"title\": \"T\"}\n",
+	} {
+		if fm, pos := MarkdownFrontMatter([]byte(in)); fm != nil || pos != 0 {
+			t.Errorf("%#v: %#v %d", in, fm, pos)
+		}
+	}
+}
+
+func TestMetadataJSONFrontMatter(t *testing.T) {
+	in := `{"title": "T", "n": 1.5, "tags": ["a", "b"], "x": {"y": null, "z": [{"k": 1}]}}
+Body
+`
+	out, pos := MarkdownMetadata([]byte(in))
+	exp := [][]string{
+		{"title", "T"},
+		{"n", "1.5"},
+		{"tags", "a"},
+		{"tags", "b"},
+		{"x.y", ""},
+		{"x.z.0.k", "1"},
+	}
+	if !metadataEqualForTesting(out, exp) {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	if in[pos:] != "Body\n" {
+		t.Errorf("%#v", in[pos:])
+	}
+}
+
+type testINIFrontMatter struct{}
+
+func (testINIFrontMatter) Format() string {
+	return "ini"
+}
+
+func (testINIFrontMatter) Split(markdown []byte) ([]byte, int, bool) {
+	return splitDelimitedFrontMatter(markdown, "[ini]", "[/ini]")
+}
+
+func (testINIFrontMatter) Parse(text []byte) (*FrontMatterMap, error) {
+	m := NewFrontMatterMap()
+	m.Set("text", string(text))
+	return m, nil
+}
+
+func TestRegisterFrontMatterParser(t *testing.T) {
+	saved := frontMatterParsers
+	defer func() { frontMatterParsers = saved }()
+	RegisterFrontMatterParser(testINIFrontMatter{})
+	in := "[ini]\na=b\n[/ini]\nBody\n"
+	fm, pos := MarkdownFrontMatter([]byte(in))
+	if fm == nil || fm.Format != "ini" || in[pos:] != "Body\n" {
+		t.Fatalf("%#v %d", fm, pos)
+	}
+	if s, _ := fm.String("text"); s != "a=b\n" {
+		t.Errorf("%#v", s)
+	}
+}
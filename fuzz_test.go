@@ -0,0 +1,81 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+// fuzzCorpus seeds the fuzz tests with the edge cases of metadata, summary
+// markers and body rendering.
+var fuzzCorpus = []string{
+	"",
+	"\n",
+	"///",
+	"\n///\n",
+	"x\n///\n",
+	"\n///\n///",
+	"\n///\n///\n",
+	"A: b",
+	"A: b\n",
+	"A: b\n\n///\n",
+	"A: b\n  continued\nnot metadata",
+	"  indented: first",
+	"---",
+	"---\n",
+	"---\na: [1\n---\n",
+	"---\na: b\n...\n",
+	"+++\n",
+	"+++\na = \n+++\n",
+	"+++\n[[a]]\n[a]\n+++\n",
+	"{",
+	"{}",
+	"{\"a\": [1, {\"b\": null}]}\n",
+	"% Title\n% Author\n",
+	"# Heading\n\n* a\n  * b\n\n1. c\n\n> quote\n",
+	"| a | b |\n|---|---|\n| 1 | 2 |\n",
+	"```\ncode\n```\n",
+	"Term\n: Definition\n",
+	"<div><p>html</p></div>\n\n<b>bold",
+	"&amp; &nbsp; &#0; &#xFFFFFF;",
+	"\"quotes\" -- dashes --- ... (c)",
+	"![image](missing.png)",
+	"\x00\x01\x02\x03\x04\x05\x06\x07\x08\x0b\x0c",
+	"a  \nb\\\nc",
+	"0|\n---|---",
+	"\x03",
+	"\xe3\xf0\x1b",
+	"a | b\n---|---\nx\x1b | 2\n",
+	"b\n :\n\n:\n/f",
+}
+
+func FuzzMetadata(f *testing.F) {
+	for _, s := range fuzzCorpus {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		items, pos := MarkdownMetadata([]byte(in))
+		if pos < 0 || pos > len(in) {
+			t.Fatalf("%#v: position %d out of range", in, pos)
+		}
+		m, spos, err := ParseMetadataStrict([]byte(in))
+		if err == nil && (spos != pos || len(m) != len(items)) {
+			t.Fatalf("%#v: strict %#v %d != %#v %d", in, m, spos, items, pos)
+		}
+	})
+}
+
+func FuzzMarkdownToText(f *testing.F) {
+	for _, s := range fuzzCorpus {
+		f.Add(s, 40, true)
+	}
+	f.Fuzz(func(t *testing.T, in string, width int, color bool) {
+		if width < -1 || width > 200 {
+			return
+		}
+		MarkdownToText([]byte(in), &Options{Width: width, Color: color})
+		MarkdownToText([]byte(in), &Options{Width: width, ASCII: true, SmartPunctuation: true, HTML: HTMLRender})
+	})
+}
@@ -1,8 +1,14 @@
 module github.com/gholt/blackfridaytext
 
-go 1.12
+go 1.19
 
 require (
 	github.com/gholt/brimtext v0.0.0-20190811231012-1fbdf4665642
-	github.com/russross/blackfriday v0.0.0-20171011182219-6d1ef893fcb0
+	github.com/russross/blackfriday/v2 v2.1.0
+	github.com/yuin/goldmark v1.7.4
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 )
@@ -0,0 +1,509 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strings"
+)
+
+// HTMLPolicy indicates how HTML embedded in the Markdown is output.
+type HTMLPolicy int
+
+const (
+	// HTMLPassthrough writes the HTML out as is; the default.
+	HTMLPassthrough HTMLPolicy = iota
+	// HTMLStrip removes all tags and comments, keeping just the text, with
+	// block elements on lines of their own and table cells spaced apart.
+	HTMLStrip
+	// HTMLEscape shows the HTML source literally, styled like code, with any
+	// control characters removed so it cannot affect the terminal.
+	HTMLEscape
+	// HTMLRender interprets common elements: <br> becomes a line break,
+	// <b>, <strong>, <em>, <kbd>, <code> and the like are styled as their
+	// Markdown equivalents, <details> becomes a block titled by its
+	// <summary>, lists and block quotes are indented, and comments, scripts
+	// and styles are dropped. Unknown tags are removed, keeping their text.
+	HTMLRender
+)
+
+const (
+	htmlText = iota
+	htmlStartTag
+	htmlEndTag
+	htmlComment
+)
+
+// htmlState tracks the HTML elements open, which may span several HTMLSpan
+// and HTMLBlock nodes.
+type htmlState struct {
+	htmlOpen  []htmlGroup
+	htmlLinks []string
+	htmlSkip  int
+	htmlPre   int
+	// htmlPreStart is set just after a <pre> tag.
+	htmlPreStart bool
+}
+
+// copy returns the state sharing nothing that will change with s.
+func (s htmlState) copy() htmlState {
+	s.htmlOpen = append([]htmlGroup(nil), s.htmlOpen...)
+	s.htmlLinks = append([]string(nil), s.htmlLinks...)
+	return s
+}
+
+// htmlGroup records an open HTML element that may have started an indented
+// group; indent is that of the group's lines after the first, or empty if
+// it has not, such as a <details> before its </summary>.
+type htmlGroup struct {
+	name   string
+	indent string
+}
+
+type htmlToken struct {
+	kind        int
+	name        string
+	attrs       map[string]string
+	selfClosing bool
+	text        []byte
+}
+
+// tokenizeHTML splits src into text, tag and comment tokens. It is lenient:
+// anything that does not parse as a tag is treated as text.
+func tokenizeHTML(src []byte) []htmlToken {
+	var tokens []htmlToken
+	text := 0
+	flushText := func(end int) {
+		if end > text {
+			tokens = append(tokens, htmlToken{kind: htmlText, text: src[text:end]})
+		}
+	}
+	i := 0
+	for i < len(src) {
+		if src[i] != '<' {
+			i++
+			continue
+		}
+		var tok htmlToken
+		var size int
+		switch {
+		case bytes.HasPrefix(src[i:], []byte("<!--")):
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end == -1 {
+				size = len(src) - i
+			} else {
+				size = end + 7
+			}
+			tok.kind = htmlComment
+		case i+1 < len(src) && (src[i+1] == '!' || src[i+1] == '?'):
+			end := bytes.IndexByte(src[i:], '>')
+			if end != -1 {
+				size = end + 1
+				tok.kind = htmlComment
+			}
+		default:
+			tok, size = parseHTMLTag(src[i:])
+		}
+		if size == 0 {
+			i++
+			continue
+		}
+		flushText(i)
+		tokens = append(tokens, tok)
+		i += size
+		text = i
+	}
+	flushText(len(src))
+	return tokens
+}
+
+// parseHTMLTag parses the start or end tag at the beginning of src,
+// returning the token and its size, or a zero size if src does not begin
+// with a tag.
+func parseHTMLTag(src []byte) (htmlToken, int) {
+	tok := htmlToken{kind: htmlStartTag}
+	i := 1
+	if i < len(src) && src[i] == '/' {
+		tok.kind = htmlEndTag
+		i++
+	}
+	start := i
+	for i < len(src) && (isHTMLNameByte(src[i]) || (i > start && src[i] == '-')) {
+		i++
+	}
+	if i == start {
+		return tok, 0
+	}
+	tok.name = strings.ToLower(string(src[start:i]))
+	for {
+		for i < len(src) && isHTMLSpace(src[i]) {
+			i++
+		}
+		if i >= len(src) {
+			return tok, 0
+		}
+		switch src[i] {
+		case '>':
+			return tok, i + 1
+		case '/':
+			tok.selfClosing = true
+			i++
+			continue
+		}
+		start = i
+		for i < len(src) && !isHTMLSpace(src[i]) && src[i] != '=' && src[i] != '>' && src[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(string(src[start:i]))
+		for i < len(src) && isHTMLSpace(src[i]) {
+			i++
+		}
+		value := ""
+		if i < len(src) && src[i] == '=' {
+			i++
+			for i < len(src) && isHTMLSpace(src[i]) {
+				i++
+			}
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				end := bytes.IndexByte(src[i+1:], src[i])
+				if end == -1 {
+					return tok, 0
+				}
+				value = string(src[i+1 : i+1+end])
+				i += end + 2
+			} else {
+				start = i
+				for i < len(src) && !isHTMLSpace(src[i]) && src[i] != '>' {
+					i++
+				}
+				value = string(src[start:i])
+			}
+		}
+		if name != "" {
+			if tok.attrs == nil {
+				tok.attrs = make(map[string]string)
+			}
+			tok.attrs[name] = value
+		}
+	}
+}
+
+func isHTMLNameByte(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9')
+}
+
+func isHTMLSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\f'
+}
+
+// stripControl returns text without any control characters other than tab
+// and newline.
+func stripControl(text []byte) []byte {
+	return bytes.Map(func(r rune) rune {
+		if (r < 0x20 && r != '\t' && r != '\n') || r == 0x7f {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// html writes the HTML src according to the HTML policy; block indicates
+// whether it is block level HTML rather than a single inline tag.
+func (rend *renderer) html(out *textBuffer, src []byte, block bool) {
+	switch rend.htmlPolicy {
+	case HTMLPassthrough:
+		if block {
+			out.ensureBlankLine()
+			for i, line := range bytes.Split(src, []byte("\n")) {
+				if i > 0 {
+					out.lineBreak()
+				}
+				out.write(line)
+			}
+		} else {
+			out.write(src)
+		}
+		return
+	case HTMLEscape:
+		if block {
+			rend.blockCode(out, stripControl(src))
+		} else {
+			rend.codeSpan(out, stripControl(src))
+		}
+		return
+	}
+	if block {
+		out.ensureBlankLine()
+	}
+	start := out.len()
+	for _, tok := range tokenizeHTML(src) {
+		switch tok.kind {
+		case htmlText:
+			rend.htmlText(out, tok.text)
+		case htmlStartTag, htmlEndTag:
+			switch tok.name {
+			case "script", "style", "template", "head":
+				if tok.kind == htmlStartTag && !tok.selfClosing {
+					rend.htmlSkip++
+				} else if tok.kind == htmlEndTag && rend.htmlSkip > 0 {
+					rend.htmlSkip--
+				}
+				continue
+			}
+			if rend.htmlSkip > 0 {
+				continue
+			}
+			if rend.htmlPolicy == HTMLStrip {
+				rend.htmlStripTag(out, tok.name)
+			} else if tok.kind == htmlStartTag {
+				rend.htmlStartTag(out, tok)
+			} else {
+				rend.htmlEndTag(out, tok.name)
+			}
+		}
+	}
+	if block {
+		// As with other blocks, spacing after is left to whatever follows.
+		out.trimEnd(start, true, isHTMLSpace)
+	}
+}
+
+// htmlTrimSpace drops any trailing whitespace, which is insignificant in
+// HTML before block elements.
+func htmlTrimSpace(out *textBuffer) {
+	out.trimEnd(0, false, isHTMLSpace)
+}
+
+// htmlBreak ensures a new line or, if blank is true, a blank line.
+func (rend *renderer) htmlBreak(out *textBuffer, blank bool) {
+	htmlTrimSpace(out)
+	n := out.len()
+	for n > 0 && (out.pieces[n-1].kind == pieceStyle || out.pieces[n-1].kind == pieceStyleEnd) {
+		n--
+	}
+	if n > 0 && out.pieces[n-1].kind == pieceGroup {
+		// The group has just started a line of its own.
+		return
+	}
+	if blank {
+		out.ensureBlankLine()
+	} else {
+		out.ensureNewLine()
+	}
+}
+
+func (rend *renderer) htmlText(out *textBuffer, text []byte) {
+	if rend.htmlSkip > 0 {
+		return
+	}
+	if rend.htmlPre > 0 {
+		if rend.htmlPreStart {
+			// As in HTML, a newline right after <pre> is ignored.
+			text = bytes.TrimPrefix(text, []byte("\n"))
+			rend.htmlPreStart = false
+		}
+		for i, line := range bytes.Split(stripControl(text), []byte("\n")) {
+			if i > 0 {
+				out.lineBreak()
+			}
+			rend.writeEntities(out, line, true)
+		}
+		return
+	}
+	fields := bytes.Fields(text)
+	if len(fields) == 0 {
+		if len(text) > 0 {
+			out.writeString(" ")
+		}
+		return
+	}
+	if isHTMLSpace(text[0]) {
+		out.writeString(" ")
+	}
+	rend.writeEntities(out, stripControl(bytes.Join(fields, []byte(" "))), false)
+	if isHTMLSpace(text[len(text)-1]) {
+		out.writeString(" ")
+	}
+}
+
+// htmlStripTag keeps apart the text either side of a stripped tag as
+// HTMLRender would: block elements start new lines and table cells are
+// separated by a space.
+func (rend *renderer) htmlStripTag(out *textBuffer, name string) {
+	switch name {
+	case "td", "th":
+		out.writeString(" ")
+	case "p", "div", "section", "article", "aside", "header", "footer",
+		"main", "nav", "figure", "figcaption", "address", "table", "dl",
+		"fieldset", "form", "ul", "ol", "li", "tr", "dt", "dd", "caption",
+		"pre", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "details",
+		"summary", "hr":
+		rend.htmlBreak(out, false)
+	}
+}
+
+// htmlStyle returns the Markdown element equivalent to the HTML element,
+// if there is one.
+func htmlStyle(name string) (Element, bool) {
+	switch name {
+	case "b", "strong":
+		return ElementDoubleEmphasis, true
+	case "i", "em", "cite", "dfn", "mark", "var":
+		return ElementEmphasis, true
+	case "code", "kbd", "samp", "tt":
+		return ElementCodeSpan, true
+	case "s", "del", "strike":
+		return ElementStrikethrough, true
+	}
+	return 0, false
+}
+
+func (rend *renderer) htmlStartTag(out *textBuffer, tok htmlToken) {
+	if e, ok := htmlStyle(tok.name); ok {
+		out.startStyle(e)
+		return
+	}
+	switch tok.name {
+	case "br":
+		out.lineBreak()
+	case "hr":
+		rend.hRule(out)
+	case "img":
+		rend.image(out, []byte(tok.attrs["src"]), []byte(tok.attrs["title"]), []byte(tok.attrs["alt"]))
+	case "a":
+		href := tok.attrs["href"]
+		rend.htmlLinks = append(rend.htmlLinks, href)
+		if href != "" {
+			out.startStyle(ElementLink)
+			out.writeString("[")
+		}
+	case "sup":
+		out.writeString("^")
+	case "sub":
+		out.writeString("_")
+	case "q":
+		out.writeString("\"")
+	case "p", "div", "section", "article", "aside", "header", "footer",
+		"main", "nav", "figure", "figcaption", "address", "table", "dl",
+		"fieldset", "form":
+		rend.htmlBreak(out, true)
+	case "ul", "ol":
+		rend.htmlBreak(out, false)
+		rend.htmlOpen = append(rend.htmlOpen, htmlGroup{name: tok.name})
+	case "tr", "dt", "dd", "caption":
+		rend.htmlBreak(out, false)
+	case "td", "th":
+		out.writeString("  ")
+	case "pre":
+		rend.htmlBreak(out, true)
+		out.startStyle(ElementBlockCode)
+		rend.htmlPre++
+		rend.htmlPreStart = true
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		rend.htmlBreak(out, true)
+		if len(rend.headerPrefix) > 0 {
+			out.write(rend.headerPrefix)
+			out.writeNoWrap([]byte(" "))
+		}
+		out.startStyle(ElementHeader)
+		out.startStyle(headerElement(int(tok.name[1] - '0')))
+	case "li":
+		if n := len(rend.htmlOpen); n > 0 && rend.htmlOpen[n-1].name == "li" {
+			rend.htmlEndTag(out, "li")
+		}
+		rend.htmlBreak(out, false)
+		rend.htmlOpenGroup(out, "li", "  * ", "    ")
+	case "blockquote":
+		rend.htmlBreak(out, true)
+		rend.htmlOpenGroup(out, "blockquote", "> ", "> ")
+	case "details":
+		rend.htmlBreak(out, true)
+		rend.htmlOpen = append(rend.htmlOpen, htmlGroup{name: "details"})
+	case "summary":
+		rend.htmlBreak(out, false)
+		out.startStyle(ElementDoubleEmphasis)
+	}
+}
+
+func (rend *renderer) htmlEndTag(out *textBuffer, name string) {
+	if e, ok := htmlStyle(name); ok {
+		out.endStyle(e)
+		return
+	}
+	switch name {
+	case "a":
+		if n := len(rend.htmlLinks); n > 0 {
+			href := rend.htmlLinks[n-1]
+			rend.htmlLinks = rend.htmlLinks[:n-1]
+			if href != "" {
+				out.writeString("] ")
+				out.writeString(href)
+				out.endStyle(ElementLink)
+			}
+		}
+	case "q":
+		out.writeString("\"")
+	case "p", "div", "section", "article", "aside", "header", "footer",
+		"main", "nav", "figure", "figcaption", "address", "table", "dl",
+		"fieldset", "form":
+		rend.htmlBreak(out, true)
+	case "pre":
+		if rend.htmlPre > 0 {
+			rend.htmlPre--
+			out.endStyle(ElementBlockCode)
+		}
+		rend.htmlBreak(out, true)
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		out.endStyle(headerElement(int(name[1] - '0')))
+		out.endStyle(ElementHeader)
+		if len(rend.headerSuffix) > 0 {
+			out.writeNoWrap([]byte(" "))
+			out.write(rend.headerSuffix)
+		}
+		rend.htmlBreak(out, true)
+	case "summary":
+		out.endStyle(ElementDoubleEmphasis)
+		// The rest of the details are indented under the summary.
+		if n := len(rend.htmlOpen); n > 0 && rend.htmlOpen[n-1] == (htmlGroup{name: "details"}) {
+			rend.htmlOpen = rend.htmlOpen[:n-1]
+			rend.htmlBreak(out, false)
+			rend.htmlOpenGroup(out, "details", "    ", "    ")
+		}
+	case "li", "blockquote", "details", "ul", "ol":
+		for i := len(rend.htmlOpen) - 1; i >= 0; i-- {
+			if rend.htmlOpen[i].name == name {
+				rend.htmlCloseGroups(out, i)
+				break
+			}
+		}
+		if name == "details" || name == "blockquote" {
+			rend.htmlBreak(out, true)
+		}
+	}
+}
+
+// htmlOpenGroup starts an indented group for the HTML element name.
+func (rend *renderer) htmlOpenGroup(out *textBuffer, name string, indent1 string, indent2 string) {
+	out.startGroup([]byte(indent1), []byte(indent2))
+	rend.currentIndent += len(indent2)
+	rend.htmlOpen = append(rend.htmlOpen, htmlGroup{name: name, indent: indent2})
+}
+
+// htmlCloseGroups closes the open HTML elements from the innermost down to
+// and including the one at index i, ending any indented groups they started.
+func (rend *renderer) htmlCloseGroups(out *textBuffer, i int) {
+	if len(rend.htmlOpen) > i {
+		htmlTrimSpace(out)
+	}
+	for len(rend.htmlOpen) > i {
+		n := len(rend.htmlOpen) - 1
+		if rend.htmlOpen[n].indent != "" {
+			out.trimEnd(0, true, isHTMLSpace)
+			out.endGroup()
+			rend.currentIndent -= len(rend.htmlOpen[n].indent)
+		}
+		rend.htmlOpen = rend.htmlOpen[:n]
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestHTMLPolicies(t *testing.T) {
+	in := `Press <kbd>Ctrl</kbd>+<kbd>C</kbd> to <b>stop</b>,<br>
+or x<sup>2</sup> <!-- hidden --> <a href="http://example.com">here</a>.
+
+<div>
+  A <em>block</em> &amp; <span>more</span>.
+</div>
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80}))
+	exp := `Press <kbd>Ctrl</kbd>+<kbd>C</kbd> to <b>stop</b>,<br> or x<sup>2</sup> <!--
+hidden --> <a href="http://example.com">here</a>.
+
+<div>
+A <em>block</em> &amp; <span>more</span>.
+</div>
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, HTML: HTMLRender}))
+	exp = `Press "Ctrl"+"C" to **stop**,
+or x^2 [here] http://example.com.
+
+A *block* & more.
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, HTML: HTMLStrip}))
+	exp = `Press Ctrl+C to stop, or x2 here.
+
+A block & more.
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, HTML: HTMLEscape}))
+	exp = `Press "<kbd>"Ctrl"</kbd>"+"<kbd>"C"</kbd>" to "<b>"stop"</b>","<br>" or
+x"<sup>"2"</sup>" "<!-- hidden -->" "<a href="http://example.com">"here"</a>".
+
+<div>
+  A <em>block</em> &amp; <span>more</span>.
+</div>
+
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestHTMLRenderBlocks(t *testing.T) {
+	in := `# Header
+
+<details>
+<summary>More <i>info</i></summary>
+
+Hidden paragraph that is long enough to need wrapping at forty.
+
+</details>
+
+<ul>
+<li>One
+<li>Two<ul><li>Nested</li></ul>
+</ul>
+
+<pre>
+  keep   spacing
+</pre>
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, HTML: HTMLRender}))
+	exp := `--[ Header ]--
+
+    **More *info***
+
+        Hidden paragraph that is long
+        enough to need wrapping at
+        forty.
+
+      * One
+      * Two
+          * Nested
+      keep   spacing
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestTokenizeHTML(t *testing.T) {
+	toks := tokenizeHTML([]byte(`a < b <img src=x.png alt='An "image"'/><!--c--></A>`))
+	if len(toks) != 4 {
+		t.Fatalf("%#v", toks)
+	}
+	if string(toks[0].text) != "a < b " {
+		t.Errorf("%#v", toks[0])
+	}
+	if toks[1].name != "img" || !toks[1].selfClosing || toks[1].attrs["src"] != "x.png" || toks[1].attrs["alt"] != `An "image"` {
+		t.Errorf("%#v", toks[1])
+	}
+	if toks[2].kind != htmlComment {
+		t.Errorf("%#v", toks[2])
+	}
+	if toks[3].kind != htmlEndTag || toks[3].name != "a" {
+		t.Errorf("%#v", toks[3])
+	}
+}
+
+func TestHTMLStripBlocks(t *testing.T) {
+	in := "<ul><li>one</li><li>two</li></ul>\n\n<table><tr><th>a</th><th>b</th></tr><tr><td>1</td><td>2</td></tr></table>\n\n<div>\n<p>x</p><p>y</p>\n</div>\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, HTML: HTMLStrip}))
+	exp := "one\ntwo\n\na b\n1 2\n\nx\ny\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
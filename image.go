@@ -0,0 +1,430 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"  // registers the GIF decoder
+	_ "image/jpeg" // registers the JPEG decoder
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageProtocol indicates how images referring to local files should be
+// displayed.
+type ImageProtocol int
+
+const (
+	// ImageProtocolNone displays images as "[alt] link" text; the default.
+	ImageProtocolNone ImageProtocol = iota
+	// ImageProtocolAuto uses DetectImageProtocol to choose one of the other
+	// protocols if the output is a terminal, and ImageProtocolNone if not;
+	// as with ColorModeAuto, Render checks whether its writer is a
+	// terminal, and the functions returning the text whether os.Stdout is.
+	ImageProtocolAuto
+	// ImageProtocolKitty uses the kitty terminal graphics protocol.
+	ImageProtocolKitty
+	// ImageProtocolITerm2 uses the iTerm2 inline images protocol.
+	ImageProtocolITerm2
+	// ImageProtocolSixel uses DEC sixel graphics.
+	ImageProtocolSixel
+	// ImageProtocolBlocks draws the image with text: half-block characters
+	// colored with ANSI escape codes, or a grayscale ASCII ramp when color is
+	// disabled or Options.ASCII is set. It works on any terminal and is
+	// never chosen by DetectImageProtocol.
+	ImageProtocolBlocks
+)
+
+// asciiRamp is ordered from least to most ink, suiting dark backgrounds.
+const asciiRamp = " .:-=+*#%@"
+
+// imageCellWidth and imageCellHeight are the assumed pixel size of a
+// terminal character cell, used to convert between pixels and cells since
+// there is no portable way to ask the terminal.
+const (
+	imageCellWidth  = 10
+	imageCellHeight = 20
+)
+
+// DetectImageProtocol guesses which inline image protocol the terminal
+// supports based on the environment variables returned by getenv, which may
+// be nil to use os.Getenv. ImageProtocolNone is returned if no supported
+// terminal is recognized.
+func DetectImageProtocol(getenv func(string) string) ImageProtocol {
+	if getenv == nil {
+		getenv = os.Getenv
+	}
+	term := getenv("TERM")
+	termProgram := getenv("TERM_PROGRAM")
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "", term == "xterm-kitty",
+		termProgram == "ghostty", term == "xterm-ghostty":
+		return ImageProtocolKitty
+	case termProgram == "iTerm.app", termProgram == "WezTerm",
+		getenv("LC_TERMINAL") == "iTerm2":
+		return ImageProtocolITerm2
+	case strings.Contains(term, "sixel"), strings.HasPrefix(term, "mlterm"),
+		strings.HasPrefix(term, "foot"), strings.HasPrefix(term, "yaft"):
+		return ImageProtocolSixel
+	}
+	return ImageProtocolNone
+}
+
+// detectImageProtocol returns what DetectImageProtocol does if the output
+// is a terminal, tty, and ImageProtocolNone if not.
+func detectImageProtocol(getenv func(string) string, tty bool) ImageProtocol {
+	if !tty {
+		return ImageProtocolNone
+	}
+	return DetectImageProtocol(getenv)
+}
+
+// localImagePath returns the file path the image link refers to, or "" if
+// the link does not refer to a local file.
+func localImagePath(dir string, link []byte) string {
+	slink := string(link)
+	if slink == "" {
+		return ""
+	}
+	if u, err := url.Parse(slink); err == nil && u.Scheme != "" {
+		// Single letters are most likely Windows drive letters.
+		if len(u.Scheme) > 1 {
+			if u.Scheme != "file" {
+				return ""
+			}
+			return filepath.FromSlash(u.Path)
+		}
+	}
+	slink = filepath.FromSlash(slink)
+	if filepath.IsAbs(slink) || dir == "" {
+		return slink
+	}
+	return filepath.Join(dir, slink)
+}
+
+// inlineImage returns the lines of output to display the local image link
+// refers to, or nil if that is not possible. The graphics protocols return a
+// single line of escape sequences.
+func (rend *renderer) inlineImage(link []byte) [][]byte {
+	path := localImagePath(rend.imageDir, link)
+	if path == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return nil
+	}
+	if rend.imageProtocol == ImageProtocolBlocks {
+		return rend.blockArt(img)
+	}
+	cols := rend.availableWidth()
+	if natural := (b.Dx() + imageCellWidth - 1) / imageCellWidth; natural < cols {
+		cols = natural
+	}
+	rows := (b.Dy()*cols*imageCellWidth/b.Dx() + imageCellHeight - 1) / imageCellHeight
+	if rows < 1 {
+		rows = 1
+	}
+	switch rend.imageProtocol {
+	case ImageProtocolKitty:
+		if format != "png" {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				return nil
+			}
+			data = buf.Bytes()
+		}
+		return [][]byte{kittyImage(data, cols, rows)}
+	case ImageProtocolITerm2:
+		return [][]byte{iterm2Image(data, cols, rows)}
+	case ImageProtocolSixel:
+		return [][]byte{sixelImage(img, cols*imageCellWidth, rows*imageCellHeight)}
+	}
+	return nil
+}
+
+// blockArt returns the lines of text art for img, scaled to fit the
+// available width and the configured maximums.
+func (rend *renderer) blockArt(img image.Image) [][]byte {
+	b := img.Bounds()
+	cols := rend.availableWidth()
+	if rend.imageMaxWidth > 0 && rend.imageMaxWidth < cols {
+		cols = rend.imageMaxWidth
+	}
+	if b.Dx() < cols {
+		cols = b.Dx()
+	}
+	// Character cells are about twice as tall as they are wide, so each cell
+	// covers two pixels vertically; half-blocks draw both of them.
+	rows := (b.Dy()*cols/b.Dx() + 1) / 2
+	if rows < 1 {
+		rows = 1
+	}
+	if rend.imageMaxHeight > 0 && rows > rend.imageMaxHeight {
+		rows = rend.imageMaxHeight
+		cols = b.Dx() * rows * 2 / b.Dy()
+		if cols < 1 {
+			cols = 1
+		}
+	}
+	var lines [][]byte
+	if !rend.color || rend.ascii {
+		scaled := scaledImage(img, cols, rows)
+		for y := 0; y < rows; y++ {
+			line := make([]byte, cols)
+			for x := 0; x < cols; x++ {
+				c := scaled.NRGBAAt(x, y)
+				// Rec. 601 luma, weighted by alpha so transparency is blank.
+				l := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) * int(c.A) / 255 / 1000
+				line[x] = asciiRamp[l*len(asciiRamp)/256]
+			}
+			lines = append(lines, line)
+		}
+		return lines
+	}
+	scaled := scaledImage(img, cols, rows*2)
+	for y := 0; y < rows*2; y += 2 {
+		var line bytes.Buffer
+		for x := 0; x < cols; x++ {
+			top := scaled.NRGBAAt(x, y)
+			bottom := scaled.NRGBAAt(x, y+1)
+			switch {
+			case top.A < 128 && bottom.A < 128:
+				line.WriteString("\x1b[0m ")
+			case top.A < 128:
+				line.WriteString("\x1b[49m")
+				rend.writeArtColor(&line, 38, bottom)
+				line.WriteString("▄")
+			case bottom.A < 128:
+				line.WriteString("\x1b[49m")
+				rend.writeArtColor(&line, 38, top)
+				line.WriteString("▀")
+			default:
+				rend.writeArtColor(&line, 38, top)
+				rend.writeArtColor(&line, 48, bottom)
+				line.WriteString("▀")
+			}
+		}
+		line.WriteString("\x1b[0m")
+		lines = append(lines, line.Bytes())
+	}
+	return lines
+}
+
+// writeArtColor writes the SGR sequence setting c as the foreground (code 38)
+// or background (code 48) color, limited to the colors of the ColorMode.
+func (rend *renderer) writeArtColor(out *bytes.Buffer, code int, c color.NRGBA) {
+	art := RGBColor(c.R, c.G, c.B)
+	switch {
+	case rend.colorMode == ColorMode16, rend.colorMode == ColorMode256:
+		art = art.quantize(rend.colorMode)
+	case !rend.imageTrueColor:
+		art = art.quantize(ColorMode256)
+	}
+	out.Write(sgr(art.params(nil, code-8)))
+}
+
+// ansi256 returns the index of the xterm 256 color palette entry closest to
+// the color given, considering only the 6x6x6 color cube and the grayscale
+// ramp since the first 16 entries vary between terminals.
+func ansi256(r, g, b uint8) int {
+	levels := [6]int{0, 95, 135, 175, 215, 255}
+	nearest := func(v uint8) int {
+		best := 0
+		for i, l := range levels {
+			if abs(int(v)-l) < abs(int(v)-levels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	ri, gi, bi := nearest(r), nearest(g), nearest(b)
+	cube := 16 + 36*ri + 6*gi + bi
+	cubeDist := sq(int(r)-levels[ri]) + sq(int(g)-levels[gi]) + sq(int(b)-levels[bi])
+	avg := (int(r) + int(g) + int(b)) / 3
+	gi2 := (avg - 3) / 10
+	if gi2 < 0 {
+		gi2 = 0
+	} else if gi2 > 23 {
+		gi2 = 23
+	}
+	gv := 8 + gi2*10
+	if sq(int(r)-gv)+sq(int(g)-gv)+sq(int(b)-gv) < cubeDist {
+		return 232 + gi2
+	}
+	return cube
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sq(v int) int {
+	return v * v
+}
+
+// availableWidth returns the number of cells left for content at the current
+// indentation.
+func (rend *renderer) availableWidth() int {
+	w := rend.width - rend.currentIndent - rend.baseIndent - 1
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+func kittyImage(data []byte, cols, rows int) []byte {
+	const chunkSize = 4096
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var out bytes.Buffer
+	first := true
+	for {
+		chunk := encoded
+		if len(chunk) > chunkSize {
+			chunk = chunk[:chunkSize]
+		}
+		encoded = encoded[len(chunk):]
+		more := 0
+		if len(encoded) > 0 {
+			more = 1
+		}
+		out.WriteString("\x1b_G")
+		if first {
+			fmt.Fprintf(&out, "a=T,f=100,q=2,c=%d,r=%d,", cols, rows)
+			first = false
+		}
+		fmt.Fprintf(&out, "m=%d;%s\x1b\\", more, chunk)
+		if more == 0 {
+			break
+		}
+	}
+	return out.Bytes()
+}
+
+func iterm2Image(data []byte, cols, rows int) []byte {
+	return []byte(fmt.Sprintf(
+		"\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a",
+		len(data), cols, rows, base64.StdEncoding.EncodeToString(data)))
+}
+
+// scaledImage returns a nearest neighbor sampled copy of img sized w by h.
+func scaledImage(img image.Image, w, h int) *image.NRGBA {
+	b := img.Bounds()
+	scaled := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := 0; x < w; x++ {
+			sx := b.Min.X + x*b.Dx()/w
+			scaled.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return scaled
+}
+
+// sixelImage encodes img scaled to fit within maxw by maxh pixels as sixel
+// graphics using a fixed 6x6x6 color cube palette.
+func sixelImage(img image.Image, maxw, maxh int) []byte {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxw {
+		h = h * maxw / w
+		w = maxw
+	}
+	if h > maxh {
+		w = w * maxh / h
+		h = maxh
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	scaled := scaledImage(img, w, h)
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "\x1bPq\"1;1;%d;%d", w, h)
+	for i := 0; i < 216; i++ {
+		fmt.Fprintf(&out, "#%d;2;%d;%d;%d", i, i/36*20, i/6%6*20, i%6*20)
+	}
+	indexes := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := scaled.NRGBAAt(x, y)
+			if c.A < 128 {
+				indexes[y*w+x] = -1
+				continue
+			}
+			indexes[y*w+x] = (int(c.R)+25)/51*36 + (int(c.G)+25)/51*6 + (int(c.B)+25)/51
+		}
+	}
+	for band := 0; band < h; band += 6 {
+		var used [216]bool
+		for y := band; y < band+6 && y < h; y++ {
+			for x := 0; x < w; x++ {
+				if i := indexes[y*w+x]; i >= 0 {
+					used[i] = true
+				}
+			}
+		}
+		for i := range used {
+			if !used[i] {
+				continue
+			}
+			fmt.Fprintf(&out, "#%d", i)
+			var last byte
+			run := 0
+			flush := func() {
+				switch {
+				case run > 3:
+					fmt.Fprintf(&out, "!%d%c", run, last)
+				case run > 0:
+					for j := 0; j < run; j++ {
+						out.WriteByte(last)
+					}
+				}
+			}
+			for x := 0; x < w; x++ {
+				var bits byte
+				for y := band; y < band+6 && y < h; y++ {
+					if indexes[y*w+x] == i {
+						bits |= 1 << uint(y-band)
+					}
+				}
+				c := '?' + bits
+				if c == last {
+					run++
+					continue
+				}
+				flush()
+				last = c
+				run = 1
+			}
+			flush()
+			out.WriteByte('$')
+		}
+		out.WriteByte('-')
+	}
+	out.WriteString("\x1b\\")
+	return out.Bytes()
+}
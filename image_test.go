@@ -0,0 +1,239 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestPNG(t *testing.T, dir string, name string, w, h int) {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetectImageProtocol(t *testing.T) {
+	for _, tc := range []struct {
+		env map[string]string
+		exp ImageProtocol
+	}{
+		{map[string]string{}, ImageProtocolNone},
+		{map[string]string{"TERM": "xterm-256color"}, ImageProtocolNone},
+		{map[string]string{"TERM": "xterm-kitty"}, ImageProtocolKitty},
+		{map[string]string{"KITTY_WINDOW_ID": "1"}, ImageProtocolKitty},
+		{map[string]string{"TERM_PROGRAM": "iTerm.app"}, ImageProtocolITerm2},
+		{map[string]string{"LC_TERMINAL": "iTerm2"}, ImageProtocolITerm2},
+		{map[string]string{"TERM": "foot"}, ImageProtocolSixel},
+		{map[string]string{"TERM": "xterm-sixel"}, ImageProtocolSixel},
+	} {
+		env := tc.env
+		out := DetectImageProtocol(func(k string) string { return env[k] })
+		if out != tc.exp {
+			t.Errorf("%v: %#v != %#v", env, out, tc.exp)
+		}
+	}
+}
+
+func TestInlineImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackfridaytext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestPNG(t, dir, "pic.png", 100, 40)
+	in := "Before ![alt](pic.png) after."
+	auto := &Options{
+		Width:         40,
+		ImageProtocol: ImageProtocolAuto,
+		ImageDir:      dir,
+		Getenv: func(k string) string {
+			if k == "TERM" {
+				return "xterm-kitty"
+			}
+			return ""
+		},
+	}
+	// Auto detection is only for terminals, which os.Stdout as a character
+	// device counts as.
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	os.Stdout = null
+	out := string(MarkdownToTextNoMetadata([]byte(in), auto))
+	if !strings.HasPrefix(out, "Before\n\x1b_Ga=T,f=100,q=2,c=10,r=2,m=0;") {
+		t.Errorf("unexpected prefix %#v", out)
+	}
+	if !strings.HasSuffix(out, "\x1b\\\nafter.\n") {
+		t.Errorf("unexpected suffix %#v", out)
+	}
+	var buf bytes.Buffer
+	if _, err := Render(&buf, strings.NewReader(in), auto); err != nil {
+		t.Fatal(err)
+	}
+	exp := "Before [alt] pic.png after.\n"
+	if buf.String() != exp {
+		t.Errorf("%#v != %#v", buf.String(), exp)
+	}
+	os.Stdout, err = ioutil.TempFile(dir, "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Stdout.Close()
+	out = string(MarkdownToTextNoMetadata([]byte(in), auto))
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         40,
+		ImageProtocol: ImageProtocolITerm2,
+		ImageDir:      dir,
+	}))
+	if !strings.Contains(out, "\x1b]1337;File=inline=1;") || !strings.Contains(out, "width=10;height=2;") {
+		t.Errorf("unexpected output %#v", out)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         40,
+		ImageProtocol: ImageProtocolSixel,
+		ImageDir:      dir,
+	}))
+	if !strings.Contains(out, "\x1bPq\"1;1;100;40#0;2;0;0;0") {
+		t.Errorf("unexpected output %#v", out)
+	}
+	// Missing files and remote links fall back to the text form.
+	in = "Before ![alt](missing.png) and ![remote](http://example.com/pic.png)."
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         80,
+		ImageProtocol: ImageProtocolKitty,
+		ImageDir:      dir,
+	}))
+	exp = "Before [alt] missing.png and [remote] http://example.com/pic.png.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestBlockArtImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blackfridaytext")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeTestPNG(t, dir, "pic.png", 100, 40)
+	in := "# Header\n\n![alt](pic.png)\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         40,
+		ImageProtocol: ImageProtocolBlocks,
+		ImageDir:      dir,
+		ImageMaxWidth: 10,
+	}))
+	exp := `--[ Header ]--
+
+      ...::::-
+    --====+++*
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:          40,
+		ImageProtocol:  ImageProtocolBlocks,
+		ImageDir:       dir,
+		ImageMaxHeight: 1,
+	}))
+	exp = `--[ Header ]--
+
+     ..::
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:          40,
+		Color:          true,
+		ImageProtocol:  ImageProtocolBlocks,
+		ImageDir:       dir,
+		ImageMaxWidth:  10,
+		ImageTrueColor: true,
+	}))
+	lines := strings.Split(out, "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected 5 lines, got %d: %#v", len(lines), out)
+	}
+	if !strings.HasPrefix(lines[2], "    \x1b[38;2;0;0;128m\x1b[48;2;0;63;128m▀") {
+		t.Errorf("unexpected line %#v", lines[2])
+	}
+	if strings.Count(lines[2], "▀") != 10 {
+		t.Errorf("unexpected line %#v", lines[2])
+	}
+	for mode, prefix := range map[ColorMode]string{
+		ColorMode256: "    \x1b[38;5;18m\x1b[48;5;24m▀",
+		ColorMode16:  "    \x1b[34m\x1b[44m▀",
+	} {
+		out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+			Width:          40,
+			ColorMode:      mode,
+			ImageProtocol:  ImageProtocolBlocks,
+			ImageDir:       dir,
+			ImageMaxWidth:  10,
+			ImageTrueColor: true,
+		}))
+		if lines = strings.Split(out, "\n"); len(lines) != 5 || !strings.HasPrefix(lines[2], prefix) {
+			t.Errorf("%#v in %#v", out, mode)
+		}
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         40,
+		ColorMode:     ColorModeNone,
+		ImageProtocol: ImageProtocolBlocks,
+		ImageDir:      dir,
+		ImageMaxWidth: 10,
+	}))
+	exp = `--[ Header ]--
+
+      ...::::-
+    --====+++*
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestANSI256(t *testing.T) {
+	for _, tc := range []struct {
+		r, g, b uint8
+		exp     int
+	}{
+		{0, 0, 0, 16},
+		{255, 255, 255, 231},
+		{255, 0, 0, 196},
+		{128, 128, 128, 244},
+	} {
+		if out := ansi256(tc.r, tc.g, tc.b); out != tc.exp {
+			t.Errorf("%d,%d,%d: %d != %d", tc.r, tc.g, tc.b, out, tc.exp)
+		}
+	}
+}
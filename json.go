@@ -0,0 +1,98 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+type jsonFrontMatter struct{}
+
+func (jsonFrontMatter) Format() string {
+	return "json"
+}
+
+// Split recognizes a JSON object starting at the first byte of markdown and
+// followed by the end of its line.
+func (jsonFrontMatter) Split(markdown []byte) ([]byte, int, bool) {
+	if len(markdown) == 0 || markdown[0] != '{' {
+		return nil, 0, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(markdown))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return nil, 0, false
+	}
+	end := int(dec.InputOffset())
+	rest, pos := nextLine(markdown, end)
+	if len(rest) != 0 {
+		return nil, 0, false
+	}
+	return markdown[:end], pos, true
+}
+
+// Parse decodes the JSON object, keeping the original order of its keys.
+func (jsonFrontMatter) Parse(text []byte) (*FrontMatterMap, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	v, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(*FrontMatterMap)
+	if !ok {
+		return nil, fmt.Errorf("json: front matter is not an object")
+	}
+	return m, nil
+}
+
+// parseJSONValue reads the next value from dec, returning objects as
+// *FrontMatterMap and numbers as int64 or float64.
+func parseJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			m := NewFrontMatterMap()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				v, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				m.Set(key.(string), v)
+			}
+			_, err = dec.Token()
+			return m, err
+		case '[':
+			list := []interface{}{}
+			for dec.More() {
+				v, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			_, err = dec.Token()
+			return list, err
+		}
+		return nil, fmt.Errorf("json: unexpected %v", t)
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i, nil
+		}
+		return t.Float64()
+	}
+	return tok, nil
+}
@@ -0,0 +1,961 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gholt/brimtext"
+)
+
+// pieceKind indicates what a piece of rendered text is.
+type pieceKind int
+
+const (
+	// pieceText is text that may be wrapped at its spaces, tabs and
+	// newlines or, if nowrap is set, only at its newlines.
+	pieceText pieceKind = iota
+	// pieceBreak ends a line.
+	pieceBreak
+	// pieceGroup starts an indented group, with indent1 prefixing its first
+	// line and indent2 any others, in addition to the enclosing indentation.
+	pieceGroup
+	// pieceEnd ends the innermost indented group.
+	pieceEnd
+	// pieceRule is a horizontal rule of the text's byte, filling the line.
+	pieceRule
+	// pieceRaw is output, such as an inline image, that bypasses wrapping
+	// and counts as a single character.
+	pieceRaw
+	// pieceStyle starts text styled as its element.
+	pieceStyle
+	// pieceStyleEnd ends text styled as its element.
+	pieceStyleEnd
+	// pieceTable is a table, on lines of its own.
+	pieceTable
+)
+
+type piece struct {
+	kind    pieceKind
+	text    []byte
+	nowrap  bool
+	indent1 []byte
+	indent2 []byte
+	element Element
+	table   *Table
+}
+
+// lineEnd describes how rendered text ends, for deciding the spacing before
+// what follows.
+type lineEnd int
+
+const (
+	// endNone is nothing at all.
+	endNone lineEnd = iota
+	// endOpen is a line with content not yet ended.
+	endOpen
+	// endBreak is a line break or the start or end of an indented group.
+	endBreak
+)
+
+// lineEnds are how the last and the second to last parts of rendered text
+// end.
+type lineEnds struct {
+	last lineEnd
+	prev lineEnd
+}
+
+// then returns how the text will end once p is added.
+func (e lineEnds) then(p piece) lineEnds {
+	switch p.kind {
+	case pieceText:
+		if len(p.text) == 1 {
+			return lineEnds{endOpen, e.last}
+		}
+		return lineEnds{endOpen, endOpen}
+	case pieceGroup:
+		return lineEnds{endBreak, endOpen}
+	case pieceBreak, pieceEnd:
+		return lineEnds{endBreak, e.last}
+	case pieceRaw:
+		return lineEnds{endOpen, e.last}
+	case pieceStyle, pieceStyleEnd:
+		return e
+	}
+	return lineEnds{endOpen, endOpen}
+}
+
+// textBuffer collects rendered text as pieces, to be laid out by reflow
+// once complete.
+type textBuffer struct {
+	pieces []piece
+	// before is how any text before the buffer ended, when the buffer
+	// continues it.
+	before lineEnds
+	ends   lineEnds
+}
+
+func (out *textBuffer) add(p piece) {
+	out.pieces = append(out.pieces, p)
+	out.ends = out.ends.then(p)
+}
+
+// write adds text that may be wrapped at its spaces, tabs and newlines.
+func (out *textBuffer) write(text []byte) {
+	if len(text) > 0 {
+		out.add(piece{kind: pieceText, text: append([]byte(nil), text...)})
+	}
+}
+
+func (out *textBuffer) writeString(text string) {
+	if len(text) > 0 {
+		out.add(piece{kind: pieceText, text: []byte(text)})
+	}
+}
+
+// writeNoWrap adds text that may only be wrapped at its newlines.
+func (out *textBuffer) writeNoWrap(text []byte) {
+	if len(text) > 0 {
+		out.add(piece{kind: pieceText, text: append([]byte(nil), text...), nowrap: true})
+	}
+}
+
+func (out *textBuffer) lineBreak() {
+	out.add(piece{kind: pieceBreak})
+}
+
+func (out *textBuffer) startGroup(indent1 []byte, indent2 []byte) {
+	out.add(piece{kind: pieceGroup, indent1: append([]byte(nil), indent1...), indent2: append([]byte(nil), indent2...)})
+}
+
+func (out *textBuffer) endGroup() {
+	out.add(piece{kind: pieceEnd})
+}
+
+func (out *textBuffer) rule(c byte) {
+	out.add(piece{kind: pieceRule, text: []byte{c}})
+}
+
+func (out *textBuffer) raw(text []byte) {
+	out.add(piece{kind: pieceRaw, text: text})
+}
+
+// startStyle starts text styled as the element, until endStyle.
+func (out *textBuffer) startStyle(e Element) {
+	out.add(piece{kind: pieceStyle, element: e})
+}
+
+// endStyle ends text styled as the element. Any line breaks just written
+// are left after it, so the style ends with the line it styled.
+func (out *textBuffer) endStyle(e Element) {
+	i := len(out.pieces)
+	for i > 0 && out.pieces[i-1].kind == pieceBreak {
+		i--
+	}
+	out.pieces = append(out.pieces, piece{})
+	copy(out.pieces[i+1:], out.pieces[i:])
+	out.pieces[i] = piece{kind: pieceStyleEnd, element: e}
+}
+
+func (out *textBuffer) table(t *Table) {
+	out.add(piece{kind: pieceTable, table: t})
+}
+
+// append adds the pieces of another buffer.
+func (out *textBuffer) append(other *textBuffer) {
+	for _, p := range other.pieces {
+		out.add(p)
+	}
+}
+
+func (out *textBuffer) len() int {
+	return len(out.pieces)
+}
+
+func (out *textBuffer) recount() {
+	out.ends = out.before
+	for _, p := range out.pieces {
+		out.ends = out.ends.then(p)
+	}
+}
+
+// lastRune returns the last character written, as far as deciding whether
+// a quote opens or closes, or a space if nothing has been or a group, such
+// as that of a header prefix, has just started.
+func (out *textBuffer) lastRune() rune {
+	n := len(out.pieces)
+	for n > 0 && (out.pieces[n-1].kind == pieceStyle || out.pieces[n-1].kind == pieceStyleEnd) {
+		n--
+	}
+	if n == 0 {
+		return ' '
+	}
+	p := out.pieces[n-1]
+	switch p.kind {
+	case pieceText, pieceRule:
+		r, _ := utf8.DecodeLastRune(p.text)
+		return r
+	case pieceBreak, pieceEnd, pieceRaw, pieceTable:
+		return '\n'
+	}
+	return ' '
+}
+
+// trimBreaks drops any line breaks from the start and end.
+func (out *textBuffer) trimBreaks() {
+	start := 0
+	for start < len(out.pieces) && out.pieces[start].kind == pieceBreak {
+		start++
+	}
+	end := len(out.pieces)
+	for end > start && out.pieces[end-1].kind == pieceBreak {
+		end--
+	}
+	if start > 0 || end < len(out.pieces) {
+		out.pieces = out.pieces[start:end]
+		out.recount()
+	}
+}
+
+// trimEnd drops any trailing space, as defined by isSpace, from the text
+// after the first n pieces, along with any trailing line breaks if breaks
+// is set. Spaces that may not be wrapped are kept.
+func (out *textBuffer) trimEnd(n int, breaks bool, isSpace func(byte) bool) {
+	end := len(out.pieces)
+	for end > n {
+		p := &out.pieces[end-1]
+		if p.kind == pieceBreak && breaks {
+			end--
+			continue
+		}
+		if p.kind != pieceText || p.nowrap {
+			break
+		}
+		i := len(p.text)
+		for i > 0 && isSpace(p.text[i-1]) {
+			i--
+		}
+		if i > 0 {
+			p.text = p.text[:i]
+			break
+		}
+		end--
+	}
+	out.pieces = out.pieces[:end]
+	out.recount()
+}
+
+// ensureNewLine ends any line with content.
+func (out *textBuffer) ensureNewLine() {
+	if out.ends.last == endOpen {
+		out.lineBreak()
+	}
+}
+
+// ensureBlankLine ends any line with content and leaves a blank line after
+// it, unless there is nothing yet.
+func (out *textBuffer) ensureBlankLine() {
+	switch {
+	case out.ends.last == endOpen:
+		out.lineBreak()
+		out.lineBreak()
+	case out.ends.last == endBreak && out.ends.prev != endBreak:
+		out.lineBreak()
+	}
+}
+
+// flatten returns the text of the pieces as it would appear on a single
+// line, with non-breaking spaces as nbsp and line breaks as newlines. Styles
+// are as lay would start and end them or, if lay is nil, left out.
+func (out *textBuffer) flatten(nbsp string, lay *layout) []byte {
+	var b bytes.Buffer
+	var styles []Element
+	for _, p := range out.pieces {
+		switch p.kind {
+		case pieceStyle, pieceStyleEnd:
+			if lay != nil {
+				from := styles
+				appendSpans(nil, []piece{p}, &styles)
+				b.Write(lay.restyle(from, styles))
+			}
+		case pieceText:
+			if p.nowrap {
+				b.Write(bytes.Replace(p.text, []byte(" "), []byte(nbsp), -1))
+			} else {
+				b.Write(p.text)
+			}
+		case pieceRule:
+			b.Write(p.text)
+		case pieceBreak:
+			b.WriteByte('\n')
+		}
+	}
+	if lay != nil {
+		b.Write(lay.restyle(styles, nil))
+	}
+	return b.Bytes()
+}
+
+// layout lays out blocks as lines of text, as the options indicate.
+type layout struct {
+	opts *Options
+	// styles are those of the elements, once looked up.
+	styles map[Element]Style
+}
+
+// newLayout returns a layout for the options, which have been through
+// resolveOpts.
+func newLayout(opts *Options) *layout {
+	return &layout{opts: opts, styles: map[Element]Style{}}
+}
+
+// write writes text other than that of raw spans, converting it with
+// toASCII if the options say to.
+func (lay *layout) write(out *bytes.Buffer, text []byte) {
+	out.Write(lay.transliterate(text))
+}
+
+// transliterate returns the text converted with toASCII if the options say
+// to. Text is only converted as it is laid out, so that the Markdown is
+// parsed, and its links resolved, as written.
+func (lay *layout) transliterate(text []byte) []byte {
+	if lay.opts.ASCII {
+		return toASCII(text)
+	}
+	return text
+}
+
+// style returns the style of text styled as the element: that of
+// opts.Styles, of the element's Color option as raw bytes, or the default,
+// with the colors opts.ColorMode supports.
+func (lay *layout) style(e Element) Style {
+	if s, ok := lay.styles[e]; ok {
+		return s
+	}
+	s, ok := lay.opts.Styles[e]
+	if !ok {
+		if c := lay.color(e); c != nil {
+			s = Style{Raw: c}
+		} else {
+			s = defaultStyles[e]
+		}
+	}
+	s = s.quantize(lay.opts.ColorMode)
+	lay.styles[e] = s
+	return s
+}
+
+// stackStyle returns the style of text styled as the elements, outermost
+// first.
+func (lay *layout) stackStyle(elements []Element) Style {
+	var s Style
+	for _, e := range elements {
+		s = lay.style(e).Inside(s)
+	}
+	return s
+}
+
+func (lay *layout) color(e Element) []byte {
+	switch e {
+	case ElementHeader:
+		return lay.opts.ColorHeader
+	case ElementLink:
+		return lay.opts.ColorLink
+	case ElementImage:
+		return lay.opts.ColorImage
+	case ElementCodeSpan:
+		return lay.opts.ColorCodeSpan
+	case ElementBlockCode:
+		return lay.opts.ColorBlockCode
+	case ElementStrikethrough:
+		return lay.opts.ColorStrikethrough
+	case ElementEmphasis:
+		return lay.opts.ColorEmphasis
+	case ElementDoubleEmphasis:
+		return lay.opts.ColorDoubleEmphasis
+	case ElementTripleEmphasis:
+		return lay.opts.ColorTripleEmphasis
+	}
+	return nil
+}
+
+// delimiter returns what surrounds text styled as the element when there
+// is no color.
+func delimiter(e Element) []byte {
+	switch e {
+	case ElementCodeSpan:
+		return []byte("\"")
+	case ElementStrikethrough:
+		return []byte("~~")
+	case ElementEmphasis:
+		return []byte("*")
+	case ElementDoubleEmphasis:
+		return []byte("**")
+	case ElementTripleEmphasis:
+		return []byte("***")
+	}
+	return nil
+}
+
+// start returns what starts text styled as the element.
+func (lay *layout) start(e Element) []byte {
+	return lay.restyle(nil, []Element{e})
+}
+
+// end returns what ends text styled as the element.
+func (lay *layout) end(e Element) []byte {
+	return lay.restyle([]Element{e}, nil)
+}
+
+// restyle returns what changes the style of text from that of the elements
+// from to that of the elements to, each outermost first. With color, the
+// text within an element is restored to the style of those enclosing it.
+func (lay *layout) restyle(from []Element, to []Element) []byte {
+	if lay.opts.Color {
+		return encodeStyle(lay.stackStyle(from), lay.stackStyle(to), lay.opts.ColorReset)
+	}
+	n := 0
+	for n < len(from) && n < len(to) && from[n] == to[n] {
+		n++
+	}
+	var b []byte
+	for i := len(from) - 1; i >= n; i-- {
+		b = append(b, delimiter(from[i])...)
+	}
+	for _, e := range to[n:] {
+		b = append(b, delimiter(e)...)
+	}
+	return b
+}
+
+// blocks writes the blocks as lines wrapped to the width, with indent1
+// prefixing the first line and indent2 any others, other than horizontal
+// rules which are prefixed with the indent1 of the blocks between groups
+// they are among.
+func (lay *layout) blocks(out *bytes.Buffer, blocks []*Block, indent1 []byte, indent2 []byte) {
+	start := out.Len()
+	ruleIndent := indent1
+	for _, b := range blocks {
+		switch b.Kind {
+		case BlockText:
+			lay.text(out, b.Spans, indent1, indent2)
+		case BlockGroup:
+			innerIndent1 := append(append([]byte(nil), indent1...), b.Indent1...)
+			innerIndent2 := append(append([]byte(nil), indent2...), b.Indent2...)
+			lay.blocks(out, b.Blocks, innerIndent1, innerIndent2)
+		case BlockRule:
+			lay.write(out, ruleIndent)
+			if n := lay.opts.Width - textWidth(ruleIndent); n > 0 {
+				lay.write(out, bytes.Repeat([]byte{b.Rule}, n))
+			}
+			out.WriteByte('\n')
+		case BlockTable:
+			lay.table(out, b.Table, indent1, indent2)
+		}
+		if out.Len() > start {
+			indent1 = indent2
+		}
+		if b.Kind == BlockGroup {
+			ruleIndent = indent1
+		}
+	}
+}
+
+// word is a run of text the layout will not break.
+type word struct {
+	text  []byte
+	width int
+	raw   bool
+	// styles are those in effect at the end of the word.
+	styles []Element
+}
+
+// text writes the spans as lines wrapped to the width, with indent1
+// prefixing the first line and indent2 any others. With color, styles are
+// ended before each line break and restored after the indent, so neither
+// line breaks nor indents are styled.
+func (lay *layout) text(out *bytes.Buffer, spans []Span, indent1 []byte, indent2 []byte) {
+	start := out.Len()
+	var styles []Element
+	// styled is the style at the end of the last word written.
+	var styled []Element
+	restyle := func(from []Element, to []Element) {
+		if lay.opts.Color {
+			out.Write(lay.restyle(from, to))
+		}
+	}
+	for {
+		i := 0
+		for i < len(spans) && !spans[i].Break {
+			i++
+		}
+		// The style at the end of the line is that of the break ending
+		// it; the last line ends all styles.
+		var end []Element
+		if i < len(spans) {
+			end = spans[i].Styles
+		}
+		lineLen := 0
+		first := true
+		for _, w := range lay.words(spans[:i], &styles, end) {
+			if first {
+				indent := indent2
+				if out.Len() == start {
+					indent = indent1
+				}
+				lay.write(out, indent)
+				restyle(nil, styled)
+				lineLen = textWidth(indent) + w.width
+				first = false
+			} else if lineLen+1+w.width >= lay.opts.Width {
+				restyle(styled, nil)
+				out.WriteByte('\n')
+				lay.write(out, indent2)
+				restyle(nil, styled)
+				lineLen = textWidth(indent2) + w.width
+			} else {
+				out.WriteByte(' ')
+				lineLen += 1 + w.width
+			}
+			if w.raw {
+				out.Write(w.text)
+			} else {
+				lay.write(out, w.text)
+			}
+			styled = w.styles
+		}
+		if !first {
+			restyle(styled, nil)
+		}
+		out.WriteByte('\n')
+		if i == len(spans) {
+			break
+		}
+		spans = spans[i+1:]
+	}
+}
+
+// words splits a line of spans into words, with what changes the style
+// from styles to that of each span, and at the end to end, joined to the
+// words around it. With color, changes wait for the text they style, and
+// the spaces between words are styled as the span they are in; without,
+// the delimiters are text of their own at the start of each span. Styles
+// is updated to the style of the last word.
+func (lay *layout) words(line []Span, styles *[]Element, end []Element) []word {
+	var words []word
+	var current []byte
+	restyle := func(to []Element) {
+		if !equalElements(*styles, to) {
+			current = append(current, lay.restyle(*styles, to)...)
+			*styles = to
+		}
+	}
+	flush := func() {
+		if len(current) > 0 {
+			current = lay.transliterate(current)
+			words = append(words, word{text: current, width: textWidth(current), styles: *styles})
+			current = nil
+		}
+	}
+	for _, s := range line {
+		if !lay.opts.Color {
+			restyle(s.Styles)
+		}
+		if s.Raw {
+			flush()
+			restyle(s.Styles)
+			current = append(current, s.Text...)
+			words = append(words, word{text: current, width: 1, raw: true, styles: *styles})
+			current = nil
+			continue
+		}
+		for i := 0; i < len(s.Text); i++ {
+			c := s.Text[i]
+			if c == '\n' || ((c == ' ' || c == '\t') && !s.NoWrap) {
+				if len(current) > 0 {
+					restyle(s.Styles)
+				}
+				flush()
+			} else {
+				restyle(s.Styles)
+				current = append(current, c)
+			}
+		}
+	}
+	if len(current) == 0 && len(words) > 0 && lay.opts.Color {
+		last := &words[len(words)-1]
+		current = last.text
+		restyle(end)
+		last.text = current
+		last.styles = *styles
+	} else {
+		restyle(end)
+		flush()
+	}
+	return words
+}
+
+// equalElements returns true if the elements are the same.
+func equalElements(a []Element, b []Element) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// table writes the table aligned to fit the width, with indent1 prefixing
+// the first line and indent2 any others.
+func (lay *layout) table(out *bytes.Buffer, table *Table, indent1 []byte, indent2 []byte) {
+	columns := len(table.Alignments)
+	opts := &brimtext.AlignOptions{}
+	*opts = *lay.opts.TableAlignOptions
+	opts.Widths = make([]int, columns)
+	opts.Alignments = append([]brimtext.Alignment(nil), table.Alignments...)
+	border := lay.styleBorders(opts)
+	rows := func(cells [][]TableCell, header bool) [][][]Span {
+		var spanRows [][][]Span
+		for _, cells := range cells {
+			if len(cells) > columns {
+				cells = cells[:columns]
+			}
+			row := make([][]Span, len(cells))
+			for c, cell := range cells {
+				row[c] = cell.Spans
+				if header {
+					row[c] = withStyle(ElementTableHeader, row[c])
+				}
+				if ln := brimtext.RuneLenStripANSIEscapes(lay.cell(row[c], 0)); ln > opts.Widths[c] {
+					opts.Widths[c] = ln
+				}
+			}
+			if header && len(row) > 0 && lay.cell(row[0], 0) == "omit" {
+				continue
+			}
+			spanRows = append(spanRows, row)
+		}
+		return spanRows
+	}
+	spanRows := rows(table.Header, true)
+	if len(spanRows) > 0 {
+		spanRows = append(spanRows, nil)
+	}
+	spanRows = append(spanRows, rows(table.Body, false)...)
+	// The cells are wrapped to the widths tried, so that styles are ended
+	// and restored just where brimtext will wrap them.
+	data := func() [][]string {
+		data := make([][]string, len(spanRows))
+		for r, row := range spanRows {
+			if row == nil {
+				continue
+			}
+			data[r] = make([]string, len(row))
+			for c, spans := range row {
+				data[r][c] = lay.cell(spans, opts.Widths[c])
+			}
+		}
+		return data
+	}
+	indent := textWidth(indent1)
+	if w := textWidth(indent2); w > indent {
+		indent = w
+	}
+	overheadw := indent + brimtext.RuneLenStripANSIEscapes(opts.RowFirstUD) + brimtext.RuneLenStripANSIEscapes(opts.RowLastUD)
+	if columns > 1 {
+		overheadw += brimtext.RuneLenStripANSIEscapes(opts.RowSecondUD)
+	}
+	if columns > 2 {
+		overheadw += brimtext.RuneLenStripANSIEscapes(opts.RowUD) * (columns - 2)
+	}
+	aw := lay.opts.Width - overheadw
+	cw := 0
+	for _, w := range opts.Widths {
+		cw += w
+	}
+	ocw := cw
+	for cw > aw {
+		for i := 0; i < len(opts.Widths); i++ {
+			if opts.Widths[i] > 1 {
+				opts.Widths[i]--
+			}
+		}
+		cw = 0
+		for _, w := range opts.Widths {
+			cw += w
+		}
+		if cw == ocw {
+			break
+		}
+		ocw = cw
+	}
+	var text string
+	for {
+		good := true
+		text = brimtext.Align(data(), opts)
+		for _, line := range strings.Split(text, "\n") {
+			if brimtext.RuneLenStripANSIEscapes(line)-overheadw > aw {
+				good = false
+			}
+		}
+		if good {
+			break
+		}
+		ocw = cw
+		for i := 0; i < len(opts.Widths); i++ {
+			if opts.Widths[i] > 1 {
+				opts.Widths[i]--
+			}
+		}
+		cw = 0
+		for _, w := range opts.Widths {
+			cw += w
+		}
+		if cw == ocw {
+			break
+		}
+	}
+	if border != nil {
+		text = border.Replace(text)
+	}
+	start := out.Len()
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if line != "" {
+			if out.Len() == start {
+				lay.write(out, indent1)
+			} else {
+				lay.write(out, indent2)
+			}
+			// Non-breaking spaces were kept as U+00A0 for brimtext, which
+			// only wraps cells at spaces.
+			lay.write(out, []byte(strings.Replace(line, "\u00a0", " ", -1)))
+		}
+		out.WriteByte('\n')
+	}
+}
+
+// borderStart and borderEnd mark where the border strings of a table
+// start and end, as escape sequences to brimtext, until they are replaced
+// with what starts and ends their style.
+const (
+	borderStart = "\x1b<m"
+	borderEnd   = "\x1b>m"
+)
+
+// styleBorders marks the border strings of the options to be styled as
+// ElementTableBorder, with color, returning what replaces the marks in the
+// aligned table, or nil if they are not styled.
+func (lay *layout) styleBorders(opts *brimtext.AlignOptions) *strings.Replacer {
+	styles := []Element{ElementTableBorder}
+	if !lay.opts.Color || lay.stackStyle(styles).IsZero() {
+		return nil
+	}
+	for _, b := range []*string{
+		&opts.FirstDR, &opts.FirstLR, &opts.FirstFirstDLR, &opts.FirstDLR, &opts.FirstDL,
+		&opts.RowFirstUD, &opts.RowSecondUD, &opts.RowUD, &opts.RowLastUD,
+		&opts.FirstNilFirstUDR, &opts.FirstNilLR, &opts.FirstNilFirstUDLR, &opts.FirstNilUDLR, &opts.FirstNilLastUDL,
+		&opts.NilFirstUDR, &opts.NilLR, &opts.NilFirstUDLR, &opts.NilUDLR, &opts.NilLastUDL,
+		&opts.LastUR, &opts.LastLR, &opts.LastFirstULR, &opts.LastULR, &opts.LastUL,
+	} {
+		if *b != "" {
+			*b = borderStart + *b + borderEnd
+		}
+	}
+	// Adjacent border strings are styled as one.
+	return strings.NewReplacer(borderEnd+borderStart, "", borderStart, string(lay.restyle(nil, styles)), borderEnd, string(lay.restyle(styles, nil)))
+}
+
+// withStyle returns the spans as part of the element, outermost.
+func withStyle(e Element, spans []Span) []Span {
+	styled := make([]Span, len(spans))
+	for i, s := range spans {
+		s.Styles = append([]Element{e}, s.Styles...)
+		styled[i] = s
+	}
+	return styled
+}
+
+// cell returns the text of a table cell's spans, styled, with non-breaking
+// spaces as U+00A0 and line breaks as newlines. With color and a width, the
+// cell is wrapped to it as brimtext would wrap it, with the styles ended at
+// the end of each line and restored at the start of the next, so no style
+// carries on past its line.
+func (lay *layout) cell(spans []Span, width int) string {
+	if !lay.opts.Color {
+		var b bytes.Buffer
+		var styles []Element
+		for _, s := range spans {
+			b.Write(lay.restyle(styles, s.Styles))
+			styles = s.Styles
+			t := lay.cellText(s.Text)
+			switch {
+			case s.Break:
+				b.WriteByte('\n')
+			case s.NoWrap:
+				b.WriteString(strings.Replace(t, " ", "\u00a0", -1))
+			default:
+				b.WriteString(t)
+			}
+		}
+		b.Write(lay.restyle(styles, nil))
+		return b.String()
+	}
+	// Each rune of the cell is kept with its styles, so that the changes
+	// between them are written just where they take effect.
+	var text []rune
+	var styles [][]Element
+	for _, s := range spans {
+		t := lay.cellText(s.Text)
+		switch {
+		case s.Break:
+			t = "\n"
+		case s.NoWrap:
+			t = strings.Replace(t, " ", "\u00a0", -1)
+		}
+		for _, r := range t {
+			text = append(text, r)
+			styles = append(styles, s.Styles)
+		}
+	}
+	var b bytes.Buffer
+	var current []Element
+	write := func(i int) {
+		b.Write(lay.restyle(current, styles[i]))
+		current = styles[i]
+		b.WriteRune(text[i])
+	}
+	endLine := func() {
+		b.Write(lay.restyle(current, nil))
+		current = nil
+	}
+	if width <= 0 {
+		for i := range text {
+			write(i)
+		}
+		endLine()
+		return b.String()
+	}
+	// As brimtext.Wrap does, paragraphs are separated by blank lines and
+	// wrapped at spaces, with single newlines as spaces.
+	for p, par := range splitCellParagraphs(text) {
+		if p > 0 {
+			b.WriteString("\n\n")
+		}
+		lineLen := 0
+		start := -1
+		for i := par[0]; i <= par[1]; i++ {
+			if i < par[1] && text[i] != ' ' && text[i] != '\n' {
+				if start == -1 {
+					start = i
+				}
+				continue
+			}
+			if start == -1 {
+				continue
+			}
+			word := i - start
+			switch {
+			case lineLen == 0:
+				lineLen = word
+			case lineLen+1+word > width:
+				endLine()
+				b.WriteByte(' ')
+				lineLen = word
+			default:
+				// The space kept is the first after the word before.
+				space := start - 1
+				for space > par[0] && (text[space-1] == ' ' || text[space-1] == '\n') {
+					space--
+				}
+				b.Write(lay.restyle(current, styles[space]))
+				current = styles[space]
+				b.WriteByte(' ')
+				lineLen += 1 + word
+			}
+			for j := start; j < i; j++ {
+				write(j)
+			}
+			start = -1
+		}
+		endLine()
+	}
+	return b.String()
+}
+
+// cellText returns the text of a span of a table cell as it is given to
+// brimtext, without control characters, which it cannot wrap.
+func (lay *layout) cellText(text string) string {
+	return string(stripControl(lay.transliterate([]byte(text))))
+}
+
+// splitCellParagraphs returns the start and end of each paragraph of the
+// text, those separated by two newlines.
+func splitCellParagraphs(text []rune) [][2]int {
+	var pars [][2]int
+	start := 0
+	for i := 0; i+1 < len(text); i++ {
+		if text[i] == '\n' && text[i+1] == '\n' {
+			pars = append(pars, [2]int{start, i})
+			start = i + 2
+			i++
+		}
+	}
+	return append(pars, [2]int{start, len(text)})
+}
+
+// textWidth returns the length of the text in runes, not counting any ANSI
+// escape sequences.
+func textWidth(text []byte) int {
+	width := utf8.RuneCount(text)
+	scan := text
+	for len(scan) > 1 {
+		i := bytes.IndexByte(scan, '\x1b')
+		if i == -1 {
+			break
+		}
+		j := bytes.IndexByte(scan[i+1:], 'm')
+		if j == -1 {
+			break
+		}
+		j += 2
+		width -= j
+		scan = scan[i+j:]
+	}
+	return width
+}
+
+// wrapText returns the text wrapped to width, as Layout would, with its
+// newlines kept as line breaks.
+func wrapText(text []byte, width int, indent1 []byte, indent2 []byte) []byte {
+	return newLayout(&Options{Width: width}).wrap(text, nil, indent1, indent2)
+}
+
+// wrap returns the text wrapped to the width and styled as the elements,
+// with its newlines kept as line breaks.
+func (lay *layout) wrap(text []byte, styles []Element, indent1 []byte, indent2 []byte) []byte {
+	var spans []Span
+	for i, line := range bytes.Split(text, []byte("\n")) {
+		if i > 0 {
+			spans = append(spans, Span{Break: true, Styles: styles})
+		}
+		if len(line) > 0 {
+			spans = append(spans, Span{Text: string(line), Styles: styles})
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	if spans[len(spans)-1].Break {
+		spans = spans[:len(spans)-1]
+	}
+	var out bytes.Buffer
+	lay.text(&out, spans, indent1, indent2)
+	return out.Bytes()
+}
@@ -0,0 +1,71 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReflow(t *testing.T) {
+	var buf textBuffer
+	buf.write([]byte("one two three"))
+	buf.ensureBlankLine()
+	buf.startGroup([]byte("  * "), []byte("    "))
+	buf.write([]byte("four five six"))
+	buf.writeNoWrap([]byte(" seven eight"))
+	buf.endGroup()
+	buf.ensureBlankLine()
+	buf.rule('-')
+	var out bytes.Buffer
+	newLayout(&Options{Width: 16}).blocks(&out, newBlocks(buf.pieces, nil), []byte("> "), []byte(": "))
+	exp := "> one two three\n\n:   * four five\n:     six seven eight\n\n: --------------\n"
+	if out.String() != exp {
+		t.Errorf("%#v != %#v", out.String(), exp)
+	}
+}
+
+func TestReflowRunes(t *testing.T) {
+	var buf textBuffer
+	buf.write([]byte("Ünïcödé café naïve — “quotes”"))
+	buf.ensureBlankLine()
+	buf.rule('-')
+	var out bytes.Buffer
+	newLayout(&Options{Width: 24}).blocks(&out, newBlocks(buf.pieces, nil), []byte("│ "), []byte("│ "))
+	exp := "│ Ünïcödé café naïve —\n│ “quotes”\n\n│ ----------------------\n"
+	if out.String() != exp {
+		t.Errorf("%#v != %#v", out.String(), exp)
+	}
+}
+
+func TestEnsureBlankLine(t *testing.T) {
+	var buf textBuffer
+	buf.ensureBlankLine()
+	if len(buf.pieces) != 0 {
+		t.Errorf("%#v", buf.pieces)
+	}
+	buf.write([]byte("x"))
+	buf.ensureBlankLine()
+	buf.ensureBlankLine()
+	buf.ensureNewLine()
+	if len(buf.pieces) != 3 {
+		t.Errorf("%#v", buf.pieces)
+	}
+	// Continuing text that ended with a single line break.
+	buf = textBuffer{before: lineEnds{endBreak, endOpen}, ends: lineEnds{endBreak, endOpen}}
+	buf.ensureBlankLine()
+	if len(buf.pieces) != 1 {
+		t.Errorf("%#v", buf.pieces)
+	}
+}
+
+func TestControlBytes(t *testing.T) {
+	// Control bytes in the markdown are just text.
+	out := string(MarkdownToTextNoMetadata([]byte("a\x03b\x06c\x01"), &Options{Width: 80}))
+	exp := "a\x03b\x06c\x01\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
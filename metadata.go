@@ -0,0 +1,454 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Metadata is the metadata of a Markdown document, its items in their
+// original order. Names may repeat; Get returns the first value for a name
+// and GetAll every value. Names are compared with NormalizeMetadataKey, so
+// "Author Name" and "authorname" are the same.
+type Metadata []MetadataItem
+
+// MetadataItem is a single name and value of Metadata.
+type MetadataItem struct {
+	Name  string
+	Value string
+}
+
+// NewMetadata converts metadata in the [][]string form returned by
+// MarkdownMetadata, ignoring any []string without exactly two elements.
+func NewMetadata(items [][]string) Metadata {
+	m := make(Metadata, 0, len(items))
+	for _, item := range items {
+		if len(item) == 2 {
+			m = append(m, MetadataItem{Name: item[0], Value: item[1]})
+		}
+	}
+	return m
+}
+
+// ParseMetadata is the same as MarkdownMetadata only returning Metadata.
+func ParseMetadata(markdown []byte) (Metadata, int) {
+	items, pos := MarkdownMetadata(markdown)
+	return NewMetadata(items), pos
+}
+
+// Slices returns the metadata in the [][]string form returned by
+// MarkdownMetadata.
+func (m Metadata) Slices() [][]string {
+	items := make([][]string, 0, len(m))
+	for _, item := range m {
+		items = append(items, []string{item.Name, item.Value})
+	}
+	return items
+}
+
+// Map returns all the values for each name, keyed by the normalized name.
+func (m Metadata) Map() map[string][]string {
+	values := make(map[string][]string, len(m))
+	for _, item := range m {
+		key := NormalizeMetadataKey(item.Name)
+		values[key] = append(values[key], item.Value)
+	}
+	return values
+}
+
+// Keys returns the distinct names in the order they first appear, as first
+// written.
+func (m Metadata) Keys() []string {
+	var keys []string
+	seen := make(map[string]bool, len(m))
+	for _, item := range m {
+		key := NormalizeMetadataKey(item.Name)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, item.Name)
+		}
+	}
+	return keys
+}
+
+// Has returns true if there is an item with the name.
+func (m Metadata) Has(name string) bool {
+	_, ok := m.Get(name)
+	return ok
+}
+
+// Get returns the value of the first item with the name.
+func (m Metadata) Get(name string) (string, bool) {
+	key := NormalizeMetadataKey(name)
+	for _, item := range m {
+		if NormalizeMetadataKey(item.Name) == key {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns the values of every item with the name.
+func (m Metadata) GetAll(name string) []string {
+	var values []string
+	key := NormalizeMetadataKey(name)
+	for _, item := range m {
+		if NormalizeMetadataKey(item.Name) == key {
+			values = append(values, item.Value)
+		}
+	}
+	return values
+}
+
+// Strings returns the values for the name as a list. Repeated items each
+// give one value; a single item is split at commas and newlines, as in
+// "Tags: go, markdown". Blank entries are dropped.
+func (m Metadata) Strings(name string) []string {
+	values := m.GetAll(name)
+	if len(values) == 1 {
+		values = strings.FieldsFunc(values[0], func(r rune) bool {
+			return r == ',' || r == '\n'
+		})
+	}
+	var list []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// Int returns the first value for the name as an integer.
+func (m Metadata) Int(name string) (int64, bool) {
+	value, ok := m.Get(name)
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return i, err == nil
+}
+
+// Bool returns the first value for the name as a boolean; besides "true"
+// and "false" and the like, "yes", "no", "on" and "off" are understood.
+func (m Metadata) Bool(name string) (bool, bool) {
+	value, ok := m.Get(name)
+	if !ok {
+		return false, false
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "y", "on":
+		return true, true
+	case "no", "n", "off":
+		return false, true
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	return b, err == nil
+}
+
+// metadataTimeLayouts are the layouts Time tries, in order.
+var metadataTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+}
+
+// Time returns the first value for the name as a time, accepting RFC 3339
+// and the other common date and time forms found in metadata, such as
+// "2006-01-02 15:04" and "January 2, 2006". Times without a zone are UTC.
+func (m Metadata) Time(name string) (time.Time, bool) {
+	value, ok := m.Get(name)
+	if !ok {
+		return time.Time{}, false
+	}
+	value = strings.TrimSpace(value)
+	for _, layout := range metadataTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// MarkdownMetadata parses just the metadata from the markdown and returns the
+// metadata and the position of the rest of the markdown.
+//
+// The metadata is a [][]string where each []string will have two elements, the
+// metadata item name and the value; ParseMetadata returns it as Metadata
+// instead. Metadata is an extension of standard
+// Markdown and is documented at
+// https://github.com/fletcher/MultiMarkdown/wiki/MultiMarkdown-Syntax-Guide#metadata
+// -- names are returned as written but, per that specification, should be
+// compared with NormalizeMetadataKey. Values may continue onto following
+// indented lines and are joined with newlines. The metadata ends at the first
+// blank line; if any line before that is neither a "name: value" line nor a
+// continuation, there is assumed to be no metadata at all.
+//
+// YAML, TOML and JSON front matter is also recognized; see
+// MarkdownFrontMatter. Its nested mapping names are joined with "." and
+// lists of values become repeated items with the same name. So is a Pandoc
+// title block of "%" lines, giving "Title", "Author" and "Date" items, with
+// an "Author" item for each author.
+//
+// In addition, the rest of markdown is scanned for lines containing only
+// "///".
+//
+// If there is one "///" line, the text above that mark is considered the
+// "Summary" metadata item; the summary will also be treated as part of the
+// content (with the "///" line omitted). This is known as a "soft break".
+//
+// If there are two "///" lines, one right after the other, the summary will
+// only be contained in the "Summary" metadata item and not part of the main
+// content. This is known as a "hard break".
+//
+// Options.SummaryMarkers, Options.NoSummary and Options.SummaryText change
+// how the summary is found and returned; see MarkdownToText and
+// ParseMetadataOptions.
+func MarkdownMetadata(markdown []byte) ([][]string, int) {
+	metadata, pos, _ := parseMetadata(markdown, false, nil)
+	return metadata, pos
+}
+
+// MetadataError describes malformed metadata found by ParseMetadataStrict.
+type MetadataError struct {
+	// Line is the 1-based line of the markdown with the problem, or 0 if
+	// not known.
+	Line int
+	Msg  string
+}
+
+func (err *MetadataError) Error() string {
+	if err.Line == 0 {
+		return "metadata: " + err.Msg
+	}
+	return fmt.Sprintf("metadata: line %d: %s", err.Line, err.Msg)
+}
+
+// ParseMetadataStrict is the same as ParseMetadata except that it returns a
+// *MetadataError if the markdown starts with what looks like metadata but is
+// malformed: front matter that fails to parse, or a MultiMarkdown metadata
+// block containing a line that is neither a "name: value" line, with a name
+// of letters, digits, spaces, hyphens, underscores and periods, nor a
+// continuation. ParseMetadata instead treats such a document as having no
+// metadata, though it accepts any name before a colon. A block between "---"
+// lines is only YAML front matter if it starts with a "key:" line.
+//
+// Neither function panics on any input.
+func ParseMetadataStrict(markdown []byte) (Metadata, int, error) {
+	return ParseMetadataOptions(markdown, nil)
+}
+
+// ParseMetadataOptions is the same as ParseMetadataStrict only finding the
+// summary as configured by opts, which may be nil for the defaults.
+func ParseMetadataOptions(markdown []byte, opts *Options) (Metadata, int, error) {
+	items, pos, err := parseMetadata(markdown, true, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return NewMetadata(items), pos, nil
+}
+
+func parseMetadata(markdown []byte, strict bool, opts *Options) ([][]string, int, error) {
+	var metadata [][]string
+	var pos int
+	fm, fmPos, err := parseFrontMatter(markdown)
+	if err != nil && strict {
+		return nil, 0, &MetadataError{Msg: err.Error()}
+	}
+	if fm != nil {
+		metadata, pos = fm.items(""), fmPos
+	} else if tb, tbPos := titleBlock(markdown); tb != nil {
+		metadata, pos = tb.Slices(), tbPos
+	} else {
+		var badLine int
+		metadata, pos, badLine = multiMarkdownMetadata(markdown, strict)
+		if badLine > 0 && strict {
+			return nil, 0, &MetadataError{Line: badLine, Msg: "expected \"name: value\" or an indented continuation"}
+		}
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.NoSummary {
+		return metadata, pos, nil
+	}
+	start, end := summaryMarker(markdown, pos, opts.SummaryMarkers)
+	if start != -1 {
+		metadata = append(metadata, []string{"Summary", summaryValue(markdown[pos:start], metadata, opts)})
+		if hardStart, hardEnd := summaryMarker(markdown, end-1, opts.SummaryMarkers); hardStart == end-1 {
+			pos = hardEnd
+		}
+	}
+	return metadata, pos, nil
+}
+
+// summaryValue returns the value of the "Summary" item for the summary
+// markdown, given the metadata items before it.
+func summaryValue(summary []byte, metadata [][]string, opts *Options) string {
+	if opts.ExpandVariables {
+		summary, _ = ExpandVariables(summary, NewMetadata(metadata), opts)
+	}
+	if !opts.SummaryText {
+		return string(summary)
+	}
+	textOpts := *opts
+	textOpts.ExpandVariables = false
+	return string(MarkdownToTextNoMetadata(summary, &textOpts))
+}
+
+// summaryMarker returns the position of the newline before the first
+// summary marker line after pos and the position just after that line, or
+// -1 and -1 if there is none. A marker line must end with a newline.
+func summaryMarker(markdown []byte, pos int, markers []string) (int, int) {
+	for {
+		nl := bytes.IndexByte(markdown[pos:], '\n')
+		if nl == -1 {
+			return -1, -1
+		}
+		start := pos + nl
+		end := bytes.IndexByte(markdown[start+1:], '\n')
+		if end == -1 {
+			return -1, -1
+		}
+		end += start + 2
+		if isSummaryMarker(markdown[start+1:end-1], markers) {
+			return start, end
+		}
+		pos = start + 1
+	}
+}
+
+// isSummaryMarker returns true if the line, without its newline, is one of
+// the markers, "///" if there are none.
+func isSummaryMarker(line []byte, markers []string) bool {
+	if len(markers) == 0 {
+		markers = []string{"///"}
+	}
+	s := string(bytes.TrimRight(line, " \t\r"))
+	for _, marker := range markers {
+		if s == marker {
+			return true
+		}
+	}
+	return false
+}
+
+// stripSummaryMarkers removes every summary marker line.
+func stripSummaryMarkers(markdown []byte, markers []string) []byte {
+	var out []byte
+	pos := 0
+	for {
+		search := pos
+		if pos > 0 {
+			// The newline ending the previous marker may start another.
+			search--
+		}
+		start, end := summaryMarker(markdown, search, markers)
+		if start == -1 {
+			if out == nil {
+				return markdown
+			}
+			return append(out, markdown[pos:]...)
+		}
+		if start >= pos {
+			out = append(out, markdown[pos:start+1]...)
+		}
+		pos = end
+	}
+}
+
+// NormalizeMetadataKey returns the form of a metadata name used for
+// comparisons: MultiMarkdown metadata keys are case insensitive and ignore
+// spaces, so "Author Name" and "authorname" are the same key.
+func NormalizeMetadataKey(name string) string {
+	return strings.ToLower(strings.Replace(name, " ", "", -1))
+}
+
+// multiMarkdownMetadata parses a leading MultiMarkdown metadata block,
+// returning the items and the position just after the block's lines. If the
+// block starts like metadata but has an invalid line, there is assumed to be
+// no metadata and the 1-based number of that line is also returned. Any line
+// with a colon is a "name: value" line unless strict, when the name must
+// also pass validMetadataKey.
+func multiMarkdownMetadata(markdown []byte, strict bool) ([][]string, int, int) {
+	var metadata [][]string
+	pos := 0
+	for i, line := range bytes.Split(markdown, []byte("\n")) {
+		sline := strings.TrimRight(string(line), " \t\r")
+		if strings.Trim(sline, " \t") == "" {
+			break
+		}
+		if sline[0] == ' ' || sline[0] == '\t' {
+			if len(metadata) == 0 {
+				// A value continuation with nothing to continue.
+				return make([][]string, 0), 0, 0
+			}
+			item := metadata[len(metadata)-1]
+			if item[1] == "" {
+				item[1] = strings.Trim(sline, " \t")
+			} else {
+				item[1] += "\n" + strings.Trim(sline, " \t")
+			}
+			pos = nextMetadataLine(markdown, pos, line)
+			continue
+		}
+		colon := strings.Index(sline, ":")
+		if colon == -1 || strict && !validMetadataKey(strings.TrimRight(sline[:colon], " \t")) {
+			// Since there's no blank line separating the metadata and content,
+			// we assume there wasn't actually any metadata.
+			if len(metadata) == 0 {
+				return make([][]string, 0), 0, 0
+			}
+			return make([][]string, 0), 0, i + 1
+		}
+		name := strings.TrimRight(sline[:colon], " \t")
+		value := strings.Trim(sline[colon+1:], " \t")
+		metadata = append(metadata, []string{name, value})
+		pos = nextMetadataLine(markdown, pos, line)
+	}
+	return metadata, pos, 0
+}
+
+// nextMetadataLine returns the position after line, which starts at pos,
+// and its newline, if any.
+func nextMetadataLine(markdown []byte, pos int, line []byte) int {
+	pos += len(line) + 1
+	if pos > len(markdown) {
+		pos = len(markdown)
+	}
+	return pos
+}
+
+// validMetadataKey returns true if name starts with a letter or digit and
+// contains only those, spaces, hyphens, underscores and periods.
+func validMetadataKey(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case i > 0 && (r == ' ' || r == '-' || r == '_' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
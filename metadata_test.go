@@ -0,0 +1,263 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMetadataMultiline(t *testing.T) {
+	in := `Title: A Document
+Description: This is a long description
+    that continues onto the following lines
+	with a tab too.
+Empty:
+Author Name:
+  Someone
+
+Body text.
+`
+	out, pos := MarkdownMetadata([]byte(in))
+	exp := [][]string{
+		{"Title", "A Document"},
+		{"Description", "This is a long description\nthat continues onto the following lines\nwith a tab too."},
+		{"Empty", ""},
+		{"Author Name", "Someone"},
+	}
+	if !metadataEqualForTesting(out, exp) {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	if in[pos:] != "\nBody text.\n" {
+		t.Errorf("%#v", in[pos:])
+	}
+	for _, in := range []string{
+		"  Indented: first line\n\nText",
+		"Title: ok\njust some text\n\nText",
+	} {
+		out, pos := MarkdownMetadata([]byte(in))
+		if len(out) != 0 || pos != 0 {
+			t.Errorf("%#v: %#v %d", in, out, pos)
+		}
+	}
+	out, _ = MarkdownMetadata([]byte("Some(thing): x\nNot a key!: y\n\nText"))
+	exp = [][]string{{"Some(thing)", "x"}, {"Not a key!", "y"}}
+	if !metadataEqualForTesting(out, exp) {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestNormalizeMetadataKey(t *testing.T) {
+	for in, exp := range map[string]string{
+		"Title":       "title",
+		"Author Name": "authorname",
+		"REVIEW-date": "review-date",
+	} {
+		if out := NormalizeMetadataKey(in); out != exp {
+			t.Errorf("%#v != %#v", out, exp)
+		}
+	}
+}
+
+func TestMetadataType(t *testing.T) {
+	m, pos := ParseMetadata([]byte(`Title: A Title
+Tags: go, markdown,
+  text
+Author: One
+Author Name: Someone
+Draft: yes
+Weight: 42
+Date: 2024-01-02 03:04
+Author: Two
+
+Body
+`))
+	if pos != 132 {
+		t.Errorf("%#v", pos)
+	}
+	if v, ok := m.Get("title"); !ok || v != "A Title" {
+		t.Errorf("%#v %v", v, ok)
+	}
+	if v, ok := m.Get("authorname"); !ok || v != "Someone" {
+		t.Errorf("%#v %v", v, ok)
+	}
+	if !m.Has("AUTHOR") || m.Has("Missing") {
+		t.Error("Has")
+	}
+	if vs := m.GetAll("Author"); !reflect.DeepEqual(vs, []string{"One", "Two"}) {
+		t.Errorf("%#v", vs)
+	}
+	if vs := m.Strings("Tags"); !reflect.DeepEqual(vs, []string{"go", "markdown", "text"}) {
+		t.Errorf("%#v", vs)
+	}
+	if vs := m.Strings("Author"); !reflect.DeepEqual(vs, []string{"One", "Two"}) {
+		t.Errorf("%#v", vs)
+	}
+	if b, ok := m.Bool("Draft"); !ok || !b {
+		t.Errorf("%#v %v", b, ok)
+	}
+	if _, ok := m.Bool("Title"); ok {
+		t.Error("expected Title not to be a bool")
+	}
+	if i, ok := m.Int("Weight"); !ok || i != 42 {
+		t.Errorf("%#v %v", i, ok)
+	}
+	exp := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	if tm, ok := m.Time("Date"); !ok || !tm.Equal(exp) {
+		t.Errorf("%v %v", tm, ok)
+	}
+	if keys := m.Keys(); !reflect.DeepEqual(keys, []string{"Title", "Tags", "Author", "Author Name", "Draft", "Weight", "Date"}) {
+		t.Errorf("%#v", keys)
+	}
+	if vs := m.Map()["author"]; !reflect.DeepEqual(vs, []string{"One", "Two"}) {
+		t.Errorf("%#v", vs)
+	}
+	if back := NewMetadata(m.Slices()); !reflect.DeepEqual(back, m) {
+		t.Errorf("%#v != %#v", back, m)
+	}
+}
+
+func TestMetadataTime(t *testing.T) {
+	for in, exp := range map[string]time.Time{
+		"2024-01-02T03:04:05Z":      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"2024-01-02T03:04:05+01:00": time.Date(2024, 1, 2, 2, 4, 5, 0, time.UTC),
+		"2024-01-02":                time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"January 2, 2024":           time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"2 Jan 2024":                time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	} {
+		tm, ok := Metadata{{Name: "Date", Value: in}}.Time("date")
+		if !ok || !tm.Equal(exp) {
+			t.Errorf("%#v: %v %v", in, tm, ok)
+		}
+	}
+	if _, ok := (Metadata{{Name: "Date", Value: "someday"}}).Time("Date"); ok {
+		t.Error("expected someday not to be a time")
+	}
+}
+
+func TestMarkdownToTextMetadata(t *testing.T) {
+	m, out := MarkdownToTextMetadata([]byte("Title: T\n\nBody\n"), nil)
+	if exp := (Metadata{{Name: "Title", Value: "T"}}); !reflect.DeepEqual(m, exp) {
+		t.Errorf("%#v != %#v", m, exp)
+	}
+	if string(out) != "Body\n" {
+		t.Errorf("%#v", string(out))
+	}
+}
+
+func TestParseMetadataStrict(t *testing.T) {
+	m, pos, err := ParseMetadataStrict([]byte("A: b\n\nBody\n"))
+	if err != nil || pos != 5 || len(m) != 1 {
+		t.Errorf("%#v %d %v", m, pos, err)
+	}
+	m, pos, err = ParseMetadataStrict([]byte("Just text.\nMore: text\n"))
+	if err != nil || pos != 0 || len(m) != 0 {
+		t.Errorf("%#v %d %v", m, pos, err)
+	}
+	_, _, err = ParseMetadataStrict([]byte("A: b\nC: d\nnot metadata\n"))
+	if merr, ok := err.(*MetadataError); !ok || merr.Line != 3 {
+		t.Errorf("%#v", err)
+	} else if exp := `metadata: line 3: expected "name: value" or an indented continuation`; merr.Error() != exp {
+		t.Errorf("%#v != %#v", merr.Error(), exp)
+	}
+	_, _, err = ParseMetadataStrict([]byte("A: b\nSome(thing): x\n"))
+	if merr, ok := err.(*MetadataError); !ok || merr.Line != 2 {
+		t.Errorf("%#v", err)
+	}
+	_, _, err = ParseMetadataStrict([]byte("---\na: [1\n---\n"))
+	if _, ok := err.(*MetadataError); !ok {
+		t.Errorf("%#v", err)
+	}
+	m, pos, err = ParseMetadataStrict([]byte("---\n\nParagraph one.\n\n---\n\nMore"))
+	if err != nil || pos != 0 || len(m) != 0 {
+		t.Errorf("%#v %d %v", m, pos, err)
+	}
+	// The lenient form just finds no metadata.
+	out, pos := MarkdownMetadata([]byte("---\na: [1\n---\n"))
+	if len(out) != 0 || pos != 0 {
+		t.Errorf("%#v %d", out, pos)
+	}
+}
+
+func TestMetadataSummaryAtEnd(t *testing.T) {
+	for in, exp := range map[string]int{
+		"x\n///\n":      0,
+		"x\n///\n///":   0,
+		"x\n///\n///\n": 10,
+		"A: b":          4,
+	} {
+		_, pos := MarkdownMetadata([]byte(in))
+		if pos != exp {
+			t.Errorf("%#v: %d != %d", in, pos, exp)
+		}
+	}
+}
+
+func TestSummaryMarkers(t *testing.T) {
+	in := "Intro *text*.\n<!--more-->\nRest.\n"
+	opts := &Options{Width: 80, SummaryMarkers: []string{"<!--more-->"}}
+	out, txt := MarkdownToText([]byte(in), opts)
+	exp := [][]string{{"Summary", "Intro *text*."}}
+	if !reflect.DeepEqual(out, exp) {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	if string(txt) != "Intro *text*. Rest.\n" {
+		t.Errorf("%#v", string(txt))
+	}
+	// The default marker is no longer special.
+	out, _ = MarkdownToText([]byte("Intro.\n///\nRest.\n"), opts)
+	if len(out) != 0 {
+		t.Errorf("%#v", out)
+	}
+	// A hard break with the custom marker.
+	in = "Intro.\n<!--more-->  \n<!--more-->\nRest.\n"
+	m, pos, err := ParseMetadataOptions([]byte(in), opts)
+	if err != nil || in[pos:] != "Rest.\n" {
+		t.Errorf("%#v %v", in[pos:], err)
+	}
+	if v, _ := m.Get("Summary"); v != "Intro." {
+		t.Errorf("%#v", v)
+	}
+}
+
+func TestNoSummary(t *testing.T) {
+	in := "Intro.\n\n///\n\nRest.\n"
+	out, txt := MarkdownToText([]byte(in), &Options{Width: 80, NoSummary: true})
+	if len(out) != 0 {
+		t.Errorf("%#v", out)
+	}
+	if exp := "Intro.\n\n///\n\nRest.\n"; string(txt) != exp {
+		t.Errorf("%#v != %#v", string(txt), exp)
+	}
+}
+
+func TestSummaryText(t *testing.T) {
+	in := "Title: T\n\nAn *intro* with a [link](http://example.com).\n\n///\n///\n\nRest.\n"
+	m, txt := MarkdownToTextMetadata([]byte(in), &Options{Width: 80, SummaryText: true})
+	exp := Metadata{
+		{Name: "Title", Value: "T"},
+		{Name: "Summary", Value: "An *intro* with a [link] http://example.com.\n"},
+	}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("%#v != %#v", m, exp)
+	}
+	if string(txt) != "Rest.\n" {
+		t.Errorf("%#v", string(txt))
+	}
+}
+
+func TestStripSummaryMarkers(t *testing.T) {
+	for in, exp := range map[string]string{
+		"a\n///\nb":          "a\nb",
+		"a\n///\n///\nb":     "a\nb",
+		"a\n\n///\n\nb\n///": "a\n\n\nb\n///",
+		"///\na":             "///\na",
+	} {
+		if out := string(stripSummaryMarkers([]byte(in), nil)); out != exp {
+			t.Errorf("%#v: %#v != %#v", in, out, exp)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// MetadataLayout indicates how RenderMetadata displays metadata.
+type MetadataLayout int
+
+const (
+	// MetadataTable displays every item as "Name: value", with the values
+	// aligned and wrapped beside the names.
+	MetadataTable MetadataLayout = iota
+	// MetadataHeader displays a centered banner from the "Title" item, with
+	// "Subtitle", "Author" and "Date" items below it; other items are not
+	// displayed.
+	MetadataHeader
+	// MetadataHidden displays nothing.
+	MetadataHidden
+)
+
+// RenderMetadata returns the metadata formatted as text according to
+// opts.MetadataLayout, honoring opts.Width, opts.Color, the header style
+// and opts.ASCII. If opts is nil the defaults will be used. Nothing is
+// returned for no metadata or MetadataHidden; otherwise the text ends with
+// a newline.
+func RenderMetadata(metadata Metadata, opts *Options) []byte {
+	opts = resolveOpts(opts)
+	var out []byte
+	switch opts.MetadataLayout {
+	case MetadataTable:
+		out = renderMetadataTable(metadata, opts)
+	case MetadataHeader:
+		lay := newLayout(opts)
+		out = titleBanner(metadata, opts.Width, opts.Color, lay.start(ElementHeader), lay.end(ElementHeader))
+	}
+	if opts.ASCII {
+		out = toASCII(out)
+	}
+	return out
+}
+
+func renderMetadataTable(metadata Metadata, opts *Options) []byte {
+	nameWidth := 0
+	for _, item := range metadata {
+		if n := utf8.RuneCountInString(item.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	indent := []byte(strings.Repeat(" ", nameWidth+2))
+	lay := newLayout(opts)
+	var out bytes.Buffer
+	for _, item := range metadata {
+		text := lay.wrap([]byte(item.Value), []Element{ElementMetadataValue}, indent, indent)
+		if len(text) == 0 {
+			text = append(append([]byte{}, indent...), '\n')
+		}
+		name := item.Name + ":"
+		if opts.Color {
+			styles := []Element{ElementHeader, ElementMetadataName}
+			out.Write(lay.restyle(nil, styles))
+			out.WriteString(name)
+			out.Write(lay.restyle(styles, nil))
+		} else {
+			out.WriteString(name)
+		}
+		out.Write(text[utf8.RuneCountInString(name):])
+	}
+	return trimLineEnds(out.Bytes())
+}
+
+// titleBanner returns the centered title, subtitle and byline of the
+// MetadataHeader layout, also used for Pandoc title blocks.
+func titleBanner(metadata Metadata, width int, color bool, colorHeader []byte, colorReset []byte) []byte {
+	var out bytes.Buffer
+	if title, ok := metadata.Get("Title"); ok {
+		for _, line := range centerLines(title, width) {
+			trimmed := strings.TrimLeft(line, " ")
+			pad := line[:len(line)-len(trimmed)]
+			if color {
+				out.WriteString(pad)
+				out.Write(colorHeader)
+				out.WriteString(trimmed)
+				out.Write(colorReset)
+				out.WriteByte('\n')
+				continue
+			}
+			out.WriteString(line)
+			out.WriteByte('\n')
+			// Without color, the title is underlined to stand out.
+			out.WriteString(pad)
+			out.WriteString(strings.Repeat("=", utf8.RuneCountInString(trimmed)))
+			out.WriteByte('\n')
+		}
+	}
+	var sub []string
+	if subtitle, ok := metadata.Get("Subtitle"); ok {
+		sub = append(sub, subtitle)
+	}
+	var byline []string
+	if authors := metadata.Strings("Author"); len(authors) > 0 {
+		byline = append(byline, strings.Join(authors, ", "))
+	}
+	if date, ok := metadata.Get("Date"); ok {
+		byline = append(byline, date)
+	}
+	if len(byline) > 0 {
+		sub = append(sub, strings.Join(byline, " - "))
+	}
+	for _, s := range sub {
+		for _, line := range centerLines(s, width) {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+	return trimLineEnds(out.Bytes())
+}
+
+// centerLines wraps the text to width and returns its lines centered.
+func centerLines(text string, width int) []string {
+	wrapped := string(wrapText([]byte(text), width, nil, nil))
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(wrapped, "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if pad := (width - utf8.RuneCountInString(line)) / 2; pad > 0 {
+			line = strings.Repeat(" ", pad) + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// trimLineEnds removes trailing spaces from every line.
+func trimLineEnds(text []byte) []byte {
+	lines := bytes.Split(text, []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " ")
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
@@ -0,0 +1,64 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+var testRenderMetadata = Metadata{
+	{Name: "Title", Value: "A Rather Long Title For The Document"},
+	{Name: "Author", Value: "One, Two"},
+	{Name: "Date", Value: "2024-01-02"},
+	{Name: "Summary", Value: "This is a summary that will need to be wrapped across a couple of lines.\nAnd a second line."},
+	{Name: "Empty", Value: ""},
+}
+
+func TestRenderMetadataTable(t *testing.T) {
+	out := string(RenderMetadata(testRenderMetadata, &Options{Width: 40}))
+	exp := `Title:   A Rather Long Title For The
+         Document
+Author:  One, Two
+Date:    2024-01-02
+Summary: This is a summary that will
+         need to be wrapped across a
+         couple of lines.
+         And a second line.
+Empty:
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(RenderMetadata(testRenderMetadata[2:3], &Options{Width: 40, Color: true}))
+	exp = "\x1b[1mDate:\x1b[0m 2024-01-02\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestRenderMetadataHeader(t *testing.T) {
+	out := string(RenderMetadata(testRenderMetadata, &Options{Width: 40, MetadataLayout: MetadataHeader}))
+	exp := `  A Rather Long Title For The Document
+  ====================================
+         One, Two - 2024-01-02
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(RenderMetadata(testRenderMetadata[:1], &Options{Width: 20, Color: true, MetadataLayout: MetadataHeader}))
+	exp = "\x1b[1mA Rather Long Title\x1b[0m\n  \x1b[1mFor The Document\x1b[0m\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestRenderMetadataHidden(t *testing.T) {
+	if out := RenderMetadata(testRenderMetadata, &Options{MetadataLayout: MetadataHidden}); len(out) != 0 {
+		t.Errorf("%#v", string(out))
+	}
+	if out := RenderMetadata(nil, nil); len(out) != 0 {
+		t.Errorf("%#v", string(out))
+	}
+}
@@ -0,0 +1,425 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/russross/blackfriday/v2"
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Parser indicates which Markdown parser drives the text renderer.
+type Parser int
+
+const (
+	// ParserBlackfriday, the default, parses with Blackfriday.
+	ParserBlackfriday Parser = iota
+	// ParserCommonMark parses CommonMark, as GitHub flavored Markdown
+	// does, with goldmark and its equivalents of the Blackfriday
+	// extensions. Lists, emphasis, and HTML follow the CommonMark spec
+	// rather than Blackfriday's rules.
+	ParserCommonMark
+)
+
+// parse returns the Blackfriday syntax tree of the markdown as parsed by p
+// with the extensions; trees from other parsers are converted so
+// that the one renderer handles them all.
+func parse(markdown []byte, p Parser, extensions blackfriday.Extensions) *blackfriday.Node {
+	if p == ParserCommonMark {
+		doc := commonMark(extensions).Parser().Parse(text.NewReader(markdown))
+		root := blackfriday.NewNode(blackfriday.Document)
+		c := &converter{source: markdown, hardLineBreak: extensions&blackfriday.HardLineBreak != 0}
+		c.children(root, doc)
+		return root
+	}
+	tabSize := blackfriday.TabSizeDefault
+	if extensions&blackfriday.TabSizeEight != 0 {
+		tabSize = blackfriday.TabSizeDouble
+	}
+	markdown = expandTabs(markdown, tabSize, extensions&blackfriday.FencedCode != 0)
+	if len(markdown) > 0 && markdown[len(markdown)-1] != '\n' {
+		// Blackfriday's definition lists read past the end of the last
+		// line if it has no newline.
+		markdown = append(markdown[:len(markdown):len(markdown)], '\n')
+	}
+	return blackfriday.New(blackfriday.WithExtensions(extensions)).Parse(markdown)
+}
+
+// expandTabs returns the markdown with its tabs expanded to stops every
+// tabSize columns, as the first version of Blackfriday did before parsing
+// and the second no longer does; tabs within fenced code blocks are kept.
+func expandTabs(markdown []byte, tabSize int, fenced bool) []byte {
+	if bytes.IndexByte(markdown, '\t') == -1 {
+		return markdown
+	}
+	out := make([]byte, 0, len(markdown))
+	fenceEnd := 0
+	for pos := 0; pos < len(markdown); {
+		line, next := splitLine(markdown[pos:])
+		if fenced && pos >= fenceEnd {
+			fenceEnd = pos + fencedCodeLength(markdown[pos:])
+		}
+		if pos < fenceEnd || bytes.IndexByte(line, '\t') == -1 {
+			out = append(out, line...)
+			pos += next
+			continue
+		}
+		column := 0
+		for _, r := range string(line) {
+			if r != '\t' {
+				out = append(out, string(r)...)
+				column++
+				continue
+			}
+			for {
+				out = append(out, ' ')
+				column++
+				if column%tabSize == 0 {
+					break
+				}
+			}
+		}
+		pos += next
+	}
+	return out
+}
+
+// fencedCodeLength returns the length of the fenced code block starting
+// the text, through its closing fence, or 0 if the text does not start
+// with a closed one.
+func fencedCodeLength(text []byte) int {
+	line, pos := splitLine(text)
+	trimmed := bytes.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || !bytes.HasPrefix(trimmed, []byte("```")) && !bytes.HasPrefix(trimmed, []byte("~~~")) {
+		return 0
+	}
+	fence := trimmed[:3]
+	for len(fence) < len(trimmed) && trimmed[len(fence)] == fence[0] {
+		fence = trimmed[:len(fence)+1]
+	}
+	for pos < len(text) {
+		line, next := splitLine(text[pos:])
+		pos += next
+		trimmed := bytes.TrimLeft(line, " ")
+		if len(line)-len(trimmed) <= 3 && bytes.HasPrefix(trimmed, fence) && len(bytes.Trim(trimmed, string(fence[:1])+" \t\r\n")) == 0 {
+			return pos
+		}
+	}
+	return 0
+}
+
+// commonMark returns a goldmark Markdown with the equivalents of the
+// Blackfriday extensions; the rest, such as SpaceHeadings, are CommonMark's
+// behavior anyway or have no equivalent.
+func commonMark(extensions blackfriday.Extensions) goldmark.Markdown {
+	var extenders []goldmark.Extender
+	for _, e := range []struct {
+		flag     blackfriday.Extensions
+		extender goldmark.Extender
+	}{
+		{blackfriday.Tables, extension.Table},
+		{blackfriday.Strikethrough, extension.Strikethrough},
+		{blackfriday.Autolink, extension.Linkify},
+		{blackfriday.DefinitionLists, extension.DefinitionList},
+		{blackfriday.Footnotes, extension.Footnote},
+	} {
+		if extensions&e.flag != 0 {
+			extenders = append(extenders, e.extender)
+		}
+	}
+	var options []parser.Option
+	if extensions&blackfriday.HeadingIDs != 0 {
+		options = append(options, parser.WithAttribute())
+	}
+	return goldmark.New(goldmark.WithExtensions(extenders...), goldmark.WithParserOptions(options...))
+}
+
+// converter converts a goldmark syntax tree into a Blackfriday one.
+type converter struct {
+	source []byte
+	// hardLineBreak set true makes every newline in text a line break.
+	hardLineBreak bool
+}
+
+// children appends the conversions of the goldmark node's children to
+// parent.
+func (c *converter) children(parent *blackfriday.Node, node gast.Node) {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		c.convert(parent, child)
+	}
+}
+
+// convert appends the Blackfriday equivalent of the goldmark node, and its
+// descendants, to parent.
+func (c *converter) convert(parent *blackfriday.Node, node gast.Node) {
+	source := c.source
+	add := func(typ blackfriday.NodeType) *blackfriday.Node {
+		n := blackfriday.NewNode(typ)
+		parent.AppendChild(n)
+		return n
+	}
+	switch node := node.(type) {
+	case *gast.Paragraph, *gast.TextBlock:
+		// goldmark leaves a paragraph of only link reference definitions
+		// empty.
+		if node.HasChildren() {
+			c.children(add(blackfriday.Paragraph), node)
+		}
+	case *gast.Heading:
+		n := add(blackfriday.Heading)
+		n.Level = node.Level
+		c.children(n, node)
+	case *gast.ThematicBreak:
+		add(blackfriday.HorizontalRule)
+	case *gast.Blockquote:
+		c.children(add(blackfriday.BlockQuote), node)
+	case *gast.List:
+		n := add(blackfriday.List)
+		n.Tight = node.IsTight
+		if node.IsOrdered() {
+			n.ListFlags = blackfriday.ListTypeOrdered
+		}
+		for item := node.FirstChild(); item != nil; item = item.NextSibling() {
+			i := blackfriday.NewNode(blackfriday.Item)
+			i.ListFlags = n.ListFlags
+			n.AppendChild(i)
+			c.children(i, item)
+		}
+	case *gast.CodeBlock:
+		n := add(blackfriday.CodeBlock)
+		n.Literal = lines(node, source)
+	case *gast.FencedCodeBlock:
+		n := add(blackfriday.CodeBlock)
+		n.IsFenced = true
+		n.Info = node.Language(source)
+		n.Literal = lines(node, source)
+	case *gast.HTMLBlock:
+		n := add(blackfriday.HTMLBlock)
+		n.Literal = lines(node, source)
+		if node.HasClosure() {
+			n.Literal = append(n.Literal, node.ClosureLine.Value(source)...)
+		}
+		n.Literal = bytes.TrimRight(n.Literal, "\n")
+	case *gast.Text:
+		value := node.Segment.Value(source)
+		hardLineBreak := node.HardLineBreak() || (node.SoftLineBreak() && c.hardLineBreak)
+		if node.SoftLineBreak() && !hardLineBreak {
+			value = append(value[:len(value):len(value)], '\n')
+		}
+		if node.IsRaw() {
+			add(blackfriday.Text).Literal = value
+		} else {
+			convertText(parent, value)
+		}
+		if hardLineBreak {
+			add(blackfriday.Hardbreak)
+		}
+	case *gast.String:
+		add(blackfriday.Text).Literal = node.Value
+	case *gast.CodeSpan:
+		var literal []byte
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			if t, ok := child.(*gast.Text); ok {
+				value := t.Segment.Value(source)
+				if len(value) > 0 && value[len(value)-1] == '\n' {
+					value = append(value[:len(value)-1:len(value)-1], ' ')
+				}
+				literal = append(literal, value...)
+			} else if s, ok := child.(*gast.String); ok {
+				literal = append(literal, s.Value...)
+			}
+		}
+		add(blackfriday.Code).Literal = literal
+	case *gast.Emphasis:
+		typ := blackfriday.Emph
+		if node.Level > 1 {
+			typ = blackfriday.Strong
+		}
+		c.children(add(typ), node)
+	case *gast.Link:
+		n := add(blackfriday.Link)
+		n.Destination = unescape(node.Destination)
+		n.Title = unescape(node.Title)
+		c.children(n, node)
+	case *gast.Image:
+		n := add(blackfriday.Image)
+		n.Destination = unescape(node.Destination)
+		n.Title = unescape(node.Title)
+		c.children(n, node)
+	case *gast.AutoLink:
+		n := add(blackfriday.Link)
+		n.Destination = node.URL(source)
+		if node.AutoLinkType == gast.AutoLinkEmail && !bytes.HasPrefix(bytes.ToLower(n.Destination), []byte("mailto:")) {
+			n.Destination = append([]byte("mailto:"), n.Destination...)
+		}
+		t := blackfriday.NewNode(blackfriday.Text)
+		t.Literal = node.Label(source)
+		n.AppendChild(t)
+	case *gast.RawHTML:
+		var literal []byte
+		for i := 0; i < node.Segments.Len(); i++ {
+			segment := node.Segments.At(i)
+			literal = append(literal, segment.Value(source)...)
+		}
+		add(blackfriday.HTMLSpan).Literal = literal
+	case *east.Strikethrough:
+		c.children(add(blackfriday.Del), node)
+	case *east.Table:
+		n := add(blackfriday.Table)
+		var body *blackfriday.Node
+		for row := node.FirstChild(); row != nil; row = row.NextSibling() {
+			section := body
+			if _, ok := row.(*east.TableHeader); ok {
+				section = blackfriday.NewNode(blackfriday.TableHead)
+				n.AppendChild(section)
+			} else if body == nil {
+				body = blackfriday.NewNode(blackfriday.TableBody)
+				n.AppendChild(body)
+				section = body
+			}
+			r := blackfriday.NewNode(blackfriday.TableRow)
+			section.AppendChild(r)
+			i := 0
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				n := blackfriday.NewNode(blackfriday.TableCell)
+				n.IsHeader = section.Type == blackfriday.TableHead
+				if i < len(node.Alignments) {
+					n.Align = cellAlign(node.Alignments[i])
+				}
+				r.AppendChild(n)
+				c.children(n, cell)
+				i++
+			}
+		}
+	case *east.DefinitionList:
+		// Blackfriday has each term followed by a single definition.
+		n := add(blackfriday.List)
+		n.ListFlags = blackfriday.ListTypeDefinition
+		n.Tight = true
+		term := false
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			i := blackfriday.NewNode(blackfriday.Item)
+			i.ListFlags = blackfriday.ListTypeDefinition
+			if _, ok := child.(*east.DefinitionTerm); ok {
+				if term {
+					n.AppendChild(blackfriday.NewNode(blackfriday.Item))
+					n.LastChild.ListFlags = blackfriday.ListTypeDefinition
+				}
+				i.ListFlags |= blackfriday.ListTypeTerm
+				n.AppendChild(i)
+				p := blackfriday.NewNode(blackfriday.Paragraph)
+				i.AppendChild(p)
+				c.children(p, child)
+				term = true
+				continue
+			}
+			if !term {
+				t := blackfriday.NewNode(blackfriday.Item)
+				t.ListFlags = blackfriday.ListTypeDefinition | blackfriday.ListTypeTerm
+				n.AppendChild(t)
+			}
+			n.AppendChild(i)
+			c.children(i, child)
+			term = false
+		}
+		if term {
+			n.AppendChild(blackfriday.NewNode(blackfriday.Item))
+			n.LastChild.ListFlags = blackfriday.ListTypeDefinition
+		}
+	case *east.FootnoteLink:
+		add(blackfriday.Link).NoteID = node.Index
+	case *east.FootnoteBacklink:
+	case *east.FootnoteList:
+		n := add(blackfriday.List)
+		n.ListFlags = blackfriday.ListTypeOrdered
+		n.IsFootnotesList = true
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			i := blackfriday.NewNode(blackfriday.Item)
+			i.ListFlags = blackfriday.ListTypeOrdered
+			if footnote, ok := child.(*east.Footnote); ok {
+				i.RefLink = footnote.Ref
+			}
+			n.AppendChild(i)
+			c.children(i, child)
+		}
+	default:
+		c.children(parent, node)
+	}
+}
+
+// lines returns the lines of the block node.
+func lines(node gast.Node, source []byte) []byte {
+	var literal []byte
+	for i := 0; i < node.Lines().Len(); i++ {
+		segment := node.Lines().At(i)
+		literal = append(literal, segment.Value(source)...)
+	}
+	return literal
+}
+
+var entityPattern = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[a-zA-Z][a-zA-Z0-9]{1,31});`)
+
+// convertText appends Text nodes for the text, with backslash escapes
+// removed and, as Blackfriday does, each HTML entity in a node of its own.
+func convertText(parent *blackfriday.Node, value []byte) {
+	var plain []byte
+	flush := func() {
+		if len(plain) > 0 {
+			n := blackfriday.NewNode(blackfriday.Text)
+			n.Literal = plain
+			parent.AppendChild(n)
+			plain = nil
+		}
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) && util.IsPunct(value[i+1]) {
+			plain = append(plain, value[i+1])
+			i++
+			continue
+		}
+		if c == '&' {
+			if entity := entityPattern.Find(value[i:]); entity != nil {
+				flush()
+				n := blackfriday.NewNode(blackfriday.Text)
+				n.Literal = append([]byte(nil), entity...)
+				parent.AppendChild(n)
+				i += len(entity) - 1
+				continue
+			}
+		}
+		plain = append(plain, c)
+	}
+	flush()
+}
+
+// unescape returns a link destination or title with its backslash escapes
+// and HTML entities resolved.
+func unescape(value []byte) []byte {
+	if len(value) == 0 {
+		return nil
+	}
+	return util.ResolveEntityNames(util.ResolveNumericReferences(util.UnescapePunctuations(value)))
+}
+
+func cellAlign(align east.Alignment) blackfriday.CellAlignFlags {
+	switch align {
+	case east.AlignLeft:
+		return blackfriday.TableAlignmentLeft
+	case east.AlignRight:
+		return blackfriday.TableAlignmentRight
+	case east.AlignCenter:
+		return blackfriday.TableAlignmentCenter
+	}
+	return 0
+}
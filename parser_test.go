@@ -0,0 +1,136 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+func TestParserCommonMark(t *testing.T) {
+	in := "- one\n- two\n\n  three\n\n1) four\n\n*a **b** c*\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Parser: ParserCommonMark}))
+	exp := "  * one\n  * two\n\n    three\n  * four\n\n*a **b** c*\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	in = "Term\n: def &copy; ~~x~~\n\n| a | b |\n|--:|---|\n| 1 | 2 |\n\nSee <a@b.c>.\nline\\\nbreak\n"
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Parser: ParserCommonMark}))
+	exp = "Term  def \u00a9 ~~x~~\n\n+---+---+\n| a | b |\n+---+---+\n| 1 | 2 |\n+---+---+\n\nSee a@b.c. line\nbreak\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	in = "See [r].\n\n[r]: http://example.com\n"
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Parser: ParserCommonMark}))
+	exp = "See [r] http://example.com.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestParserTabs(t *testing.T) {
+	in := "\ta\tb\n\n```\na\tb\n```\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80}))
+	exp := "a   b\n\na\tb\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, Extensions: DefaultExtensions | blackfriday.TabSizeEight}))
+	exp = "    a       b\n\na\tb\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+// commonMarkSpecDifferences are the spec examples whose text differs from
+// that of their expected HTML, and why.
+var commonMarkSpecDifferences = map[int]string{}
+
+func init() {
+	for reason, examples := range map[string][]int{
+		"link destinations are shown as written rather than percent encoded": {32, 33, 195, 202, 206, 489, 502, 503, 504, 507},
+		"links whose text is their destination are shown just once":          {20, 346, 480, 481, 526, 538, 594, 595, 596, 597, 598, 599, 600, 601, 603, 604, 605},
+		"links with no destination or text keep their brackets":              {200, 484, 485, 486, 567},
+		"content is indented under headers, unlike after HTML headings":      {59, 62, 68, 71, 72, 76, 77, 78, 80, 84, 91, 96, 103, 115, 141, 214, 215, 228, 229, 230, 232, 300},
+		"spaces within code spans are kept rather than collapsed":            {138, 331, 332, 335, 337, 640},
+		"non-breaking spaces within HTML are collapsed as other spaces are":  {25, 333, 334, 353},
+		"newline character references are reflowed as spaces":                {39},
+		"HTML comments starting \"<!-->\" are not recognized":                {626},
+	} {
+		for _, example := range examples {
+			commonMarkSpecDifferences[example] = reason
+		}
+	}
+}
+
+// TestCommonMarkSpec renders each example of the CommonMark spec with
+// ParserCommonMark and checks the lines of the text, indentation and all,
+// are those of the example's expected HTML rendered with HTMLRender, other
+// than for the known commonMarkSpecDifferences. Blank lines are not
+// compared, as HTML marks the spacing between blocks differently.
+func TestCommonMarkSpec(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []struct {
+		Markdown string
+		HTML     string
+		Example  int
+		Section  string
+	}
+	if err := json.Unmarshal(data, &examples); err != nil {
+		t.Fatal(err)
+	}
+	// Without color, styles would be marked differently for Markdown and
+	// HTML; with it, empty escape codes leave just the words.
+	none := []byte{}
+	opts := &Options{
+		Width:               80,
+		Color:               true,
+		ColorHeader:         none,
+		ColorLink:           none,
+		ColorImage:          none,
+		ColorCodeSpan:       none,
+		ColorBlockCode:      none,
+		ColorStrikethrough:  none,
+		ColorEmphasis:       none,
+		ColorDoubleEmphasis: none,
+		ColorTripleEmphasis: none,
+		ColorReset:          none,
+		HeaderPrefix:        none,
+		HeaderSuffix:        none,
+		HTML:                HTMLRender,
+		NoSummary:           true,
+		Parser:              ParserCommonMark,
+	}
+	for _, e := range examples {
+		if _, ok := commonMarkSpecDifferences[e.Example]; ok {
+			continue
+		}
+		out := specLines(MarkdownToTextNoMetadata([]byte(e.Markdown), opts))
+		exp := specLines(MarkdownToTextNoMetadata([]byte(e.HTML), opts))
+		if !reflect.DeepEqual(out, exp) {
+			t.Errorf("example %d (%s): %#v != %#v", e.Example, e.Section, out, exp)
+		}
+	}
+}
+
+// specLines returns the lines of the text that are not blank, keeping their
+// indentation but not trailing spaces.
+func specLines(text []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(text), "\n") {
+		if line = strings.TrimRight(line, " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
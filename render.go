@@ -0,0 +1,139 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"github.com/russross/blackfriday/v2"
+)
+
+// NodeRenderer renders the nodes of the parsed Markdown, as Blackfriday's
+// Walk visits them, into a Writer. Set as Options.Renderer, it replaces the
+// default rendering; embed BaseRenderer to keep the default for any nodes it
+// does not render itself:
+//
+//	type renderer struct {
+//	    blackfridaytext.BaseRenderer
+//	}
+//
+//	func (r *renderer) RenderNode(w *blackfridaytext.Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+//	    if node.Type == blackfriday.Code {
+//	        w.WriteString("<" + string(node.Literal) + ">")
+//	        return blackfriday.GoToNext
+//	    }
+//	    return r.BaseRenderer.RenderNode(w, node, entering)
+//	}
+//
+// A node with children is visited both entering and leaving it, unless
+// SkipChildren is returned on entering; the default for some nodes sets
+// aside the text of their children when entering and uses it when leaving,
+// so such a node should be rendered either way by the same renderer.
+type NodeRenderer interface {
+	RenderNode(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus
+}
+
+// BaseRenderer is the default NodeRenderer.
+type BaseRenderer struct{}
+
+// RenderNode renders the node as MarkdownToText does by default.
+func (BaseRenderer) RenderNode(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	return w.rend.renderNode(node, entering)
+}
+
+// Writer is where a NodeRenderer renders text, which is laid out once the
+// whole document is rendered: wrapped to the width, indented within groups,
+// and styled as the elements it is part of.
+type Writer struct {
+	rend *renderer
+	// groups are the indent1 and indent2 of the groups started.
+	groups [][2]string
+}
+
+// Options returns the options the document is being rendered with, with
+// any defaults filled in.
+func (w *Writer) Options() *Options {
+	return w.rend.layout.opts
+}
+
+// Write adds text that may be wrapped at its spaces, tabs and newlines. It
+// always returns len(text) and nil, satisfying io.Writer.
+func (w *Writer) Write(text []byte) (int, error) {
+	w.rend.top().write(text)
+	return len(text), nil
+}
+
+// WriteString adds text as Write does.
+func (w *Writer) WriteString(text string) {
+	w.rend.top().writeString(text)
+}
+
+// WriteNoWrap adds text that may only be wrapped at its newlines.
+func (w *Writer) WriteNoWrap(text []byte) {
+	w.rend.top().writeNoWrap(text)
+}
+
+// WriteRaw adds output, such as escape codes, that is written as it is and
+// counts as a single character.
+func (w *Writer) WriteRaw(text []byte) {
+	w.rend.top().raw(append([]byte(nil), text...))
+}
+
+// LineBreak ends the line.
+func (w *Writer) LineBreak() {
+	w.rend.top().lineBreak()
+}
+
+// EnsureNewLine ends the line, if it has anything on it.
+func (w *Writer) EnsureNewLine() {
+	w.rend.top().ensureNewLine()
+}
+
+// EnsureBlankLine ends the line and leaves a blank line after it, unless
+// there is nothing yet or there is a blank line already.
+func (w *Writer) EnsureBlankLine() {
+	w.rend.top().ensureBlankLine()
+}
+
+// StartGroup starts text indented by indent1 on its first line and indent2
+// on any others, until EndGroup. As with list items, the text is rendered
+// on its own, without any blank lines at its start or end.
+func (w *Writer) StartGroup(indent1 string, indent2 string) {
+	w.rend.push()
+	w.rend.currentIndent += len(indent2)
+	w.groups = append(w.groups, [2]string{indent1, indent2})
+}
+
+// EndGroup ends the text started by the last StartGroup.
+func (w *Writer) EndGroup() {
+	n := len(w.groups)
+	if n == 0 {
+		return
+	}
+	group := w.groups[n-1]
+	w.groups = w.groups[:n-1]
+	w.rend.currentIndent -= len(group[1])
+	text := w.rend.pop()
+	text.trimBreaks()
+	out := w.rend.top()
+	out.startGroup([]byte(group[0]), []byte(group[1]))
+	out.append(text)
+	out.endGroup()
+}
+
+// Rule adds a horizontal rule of c on a line of its own, filling the width.
+func (w *Writer) Rule(c byte) {
+	w.rend.top().ensureNewLine()
+	w.rend.top().rule(c)
+	w.rend.top().lineBreak()
+}
+
+// StartStyle starts text styled as the element, until EndStyle.
+func (w *Writer) StartStyle(e Element) {
+	w.rend.top().startStyle(e)
+}
+
+// EndStyle ends text styled as the element.
+func (w *Writer) EndStyle(e Element) {
+	w.rend.top().endStyle(e)
+}
@@ -0,0 +1,96 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+type testRenderer struct {
+	BaseRenderer
+}
+
+func (r *testRenderer) RenderNode(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	switch node.Type {
+	case blackfriday.Code:
+		w.StartStyle(ElementCodeSpan)
+		w.WriteNoWrap([]byte("<" + string(node.Literal) + ">"))
+		w.EndStyle(ElementCodeSpan)
+		return blackfriday.GoToNext
+	case blackfriday.Link:
+		// The link text is rendered as usual, with the destination after.
+		if !entering {
+			fmt.Fprintf(w, " <%s>", node.LinkData.Destination)
+		}
+		return blackfriday.GoToNext
+	case blackfriday.BlockQuote:
+		if entering {
+			w.EnsureBlankLine()
+			w.StartGroup("| ", "| ")
+		} else {
+			w.EndGroup()
+			w.EnsureBlankLine()
+		}
+		return blackfriday.GoToNext
+	case blackfriday.HorizontalRule:
+		w.EnsureBlankLine()
+		w.Rule('=')
+		w.EnsureBlankLine()
+		return blackfriday.GoToNext
+	}
+	return r.BaseRenderer.RenderNode(w, node, entering)
+}
+
+func TestRenderer(t *testing.T) {
+	in := `Some ` + "`code`" + ` and a [*styled* link](http://example.com) here.
+
+> Quoted text that is long enough to wrap.
+
+---
+
+* item
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30, Renderer: &testRenderer{}}))
+	exp := `Some "<code>" and a *styled*
+link <http://example.com>
+here.
+
+| Quoted text that is long
+| enough to wrap.
+
+==============================
+
+  * item
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30, Renderer: BaseRenderer{}}))
+	exp = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30}))
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestWriterOptions(t *testing.T) {
+	var width int
+	r := rendererFunc(func(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+		width = w.Options().Width
+		return BaseRenderer{}.RenderNode(w, node, entering)
+	})
+	MarkdownToTextNoMetadata([]byte("x"), &Options{Width: 42, Renderer: r})
+	if width != 42 {
+		t.Errorf("%#v != %#v", width, 42)
+	}
+}
+
+type rendererFunc func(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus
+
+func (f rendererFunc) RenderNode(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	return f(w, node, entering)
+}
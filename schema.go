@@ -0,0 +1,259 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MetadataSchema describes the metadata a document should have, for
+// ValidateMetadata.
+type MetadataSchema struct {
+	Fields []MetadataField `json:"fields"`
+	// Closed set true reports any item not named by Fields.
+	Closed bool `json:"closed"`
+}
+
+// MetadataField describes one metadata item of a MetadataSchema. Every
+// value of a repeated item is checked.
+type MetadataField struct {
+	// Name is compared with NormalizeMetadataKey.
+	Name     string `json:"name"`
+	Required bool   `json:"required"`
+	// Type is "string", the default, "int", "bool" or "date"; see the
+	// Metadata getters for the forms accepted.
+	Type string `json:"type"`
+	// Values, if set, are the only values allowed.
+	Values []string `json:"values"`
+	// Pattern, if set, is a regular expression the whole value must match.
+	Pattern string `json:"pattern"`
+	// DateFormat, if set, is the time.Parse layout a date must use, such as
+	// "2006-01-02"; it implies Type "date".
+	DateFormat string `json:"dateFormat"`
+}
+
+// MetadataDiagnostic is a problem found by ValidateMetadata.
+type MetadataDiagnostic struct {
+	// Line is the 1-based line of the markdown the problem is on; problems
+	// with the document as a whole, such as missing items, are on line 1.
+	Line int
+	// Name is the metadata item name, if the problem is with an item.
+	Name string
+	Msg  string
+}
+
+func (d MetadataDiagnostic) String() string {
+	if d.Name == "" {
+		return fmt.Sprintf("%d: %s", d.Line, d.Msg)
+	}
+	return fmt.Sprintf("%d: %s: %s", d.Line, d.Name, d.Msg)
+}
+
+// ParseMetadataSchema parses a schema from JSON such as:
+//
+//	{"closed": false, "fields": [
+//	    {"name": "Title", "required": true},
+//	    {"name": "Owner", "required": true, "pattern": "^@[a-z]+$"},
+//	    {"name": "Status", "values": ["draft", "final"]},
+//	    {"name": "Review-Date", "required": true, "dateFormat": "2006-01-02"}
+//	]}
+func ParseMetadataSchema(data []byte) (*MetadataSchema, error) {
+	schema := &MetadataSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("metadata schema: %s", err)
+	}
+	if _, err := schema.compile(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// compile returns the field patterns, checking the schema is usable.
+func (schema *MetadataSchema) compile() ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(schema.Fields))
+	for i, field := range schema.Fields {
+		switch field.Type {
+		case "", "string", "int", "bool", "date":
+		default:
+			return nil, fmt.Errorf("metadata schema: %s: unknown type %q", field.Name, field.Type)
+		}
+		if field.Pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile("^(?:" + field.Pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("metadata schema: %s: %s", field.Name, err)
+		}
+		patterns[i] = re
+	}
+	return patterns, nil
+}
+
+// ValidateMetadata parses the metadata of the markdown, as
+// ParseMetadataStrict does but without a summary, and checks it against the
+// schema, returning any problems found in line order. An error is only
+// returned if the schema itself is invalid.
+func ValidateMetadata(markdown []byte, schema *MetadataSchema) ([]MetadataDiagnostic, error) {
+	patterns, err := schema.compile()
+	if err != nil {
+		return nil, err
+	}
+	// The summary is neither metadata nor part of the lines searched.
+	metadata, headerPos, err := ParseMetadataOptions(markdown, &Options{NoSummary: true})
+	if err != nil {
+		line := 1
+		if merr, ok := err.(*MetadataError); ok && merr.Line > 0 {
+			line = merr.Line
+		}
+		return []MetadataDiagnostic{{Line: line, Msg: err.Error()}}, nil
+	}
+	lines := metadataItemLines(markdown, headerPos, metadata)
+	var diags []MetadataDiagnostic
+	known := make(map[string]bool, len(schema.Fields))
+	for i, field := range schema.Fields {
+		key := NormalizeMetadataKey(field.Name)
+		known[key] = true
+		found := false
+		for j, item := range metadata {
+			if NormalizeMetadataKey(item.Name) != key {
+				continue
+			}
+			found = true
+			if msg := checkMetadataValue(item.Value, field, patterns[i]); msg != "" {
+				diags = append(diags, MetadataDiagnostic{Line: lines[j], Name: item.Name, Msg: msg})
+			}
+		}
+		if !found && field.Required {
+			diags = append(diags, MetadataDiagnostic{Line: 1, Name: field.Name, Msg: "required but missing"})
+		}
+	}
+	if schema.Closed {
+		for j, item := range metadata {
+			if !known[NormalizeMetadataKey(item.Name)] {
+				diags = append(diags, MetadataDiagnostic{Line: lines[j], Name: item.Name, Msg: "not allowed"})
+			}
+		}
+	}
+	// Stable insertion sort by line, keeping schema order within a line.
+	for i := 1; i < len(diags); i++ {
+		for j := i; j > 0 && diags[j].Line < diags[j-1].Line; j-- {
+			diags[j], diags[j-1] = diags[j-1], diags[j]
+		}
+	}
+	return diags, nil
+}
+
+// checkMetadataValue returns what is wrong with the value, if anything.
+func checkMetadataValue(value string, field MetadataField, pattern *regexp.Regexp) string {
+	m := Metadata{{Name: field.Name, Value: value}}
+	switch {
+	case field.DateFormat != "":
+		if _, err := time.Parse(field.DateFormat, strings.TrimSpace(value)); err != nil {
+			return fmt.Sprintf("%q is not a date like %q", value, field.DateFormat)
+		}
+	case field.Type == "int":
+		if _, ok := m.Int(field.Name); !ok {
+			return fmt.Sprintf("%q is not an integer", value)
+		}
+	case field.Type == "bool":
+		if _, ok := m.Bool(field.Name); !ok {
+			return fmt.Sprintf("%q is not a boolean", value)
+		}
+	case field.Type == "date":
+		if _, ok := m.Time(field.Name); !ok {
+			return fmt.Sprintf("%q is not a date", value)
+		}
+	}
+	if len(field.Values) > 0 {
+		allowed := false
+		for _, v := range field.Values {
+			if v == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Sprintf("%q is not one of %q", value, field.Values)
+		}
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return fmt.Sprintf("%q does not match %q", value, field.Pattern)
+	}
+	return ""
+}
+
+// metadataItemLines returns the 1-based line each metadata item was found
+// on, by looking for its name in the metadata before pos; for nested front
+// matter names such as "author.name" the last part is looked for. Repeated
+// names are looked for after the line of the previous one. The "Summary"
+// item is on the line the summary starts, just after pos.
+func metadataItemLines(markdown []byte, pos int, metadata Metadata) []int {
+	header := bytes.Split(markdown[:pos], []byte("\n"))
+	next := make(map[string]int)
+	lines := make([]int, len(metadata))
+	for i, item := range metadata {
+		if i == len(metadata)-1 && item.Name == "Summary" {
+			lines[i] = bytes.Count(markdown[:pos], []byte("\n")) + 1
+			continue
+		}
+		name := item.Name
+		parts := strings.Split(name, ".")
+		for j := len(parts) - 1; j > 0; j-- {
+			if strings.IndexFunc(parts[j], func(r rune) bool { return !unicode.IsDigit(r) }) != -1 {
+				name = parts[j]
+				break
+			}
+		}
+		key := NormalizeMetadataKey(name)
+		line := 0
+		for n := next[key]; n < len(header); n++ {
+			if lineHasMetadataName(string(header[n]), name) {
+				line = n + 1
+				break
+			}
+		}
+		if line == 0 {
+			// Repeated values on one line, as in a list, or not found.
+			line = next[key]
+		}
+		if line == 0 {
+			line = 1
+		}
+		next[key] = line
+		lines[i] = line
+	}
+	return lines
+}
+
+// lineHasMetadataName returns true if the name appears in the line as a
+// key: not within a word, and followed by ":" or "=" after any quote.
+func lineHasMetadataName(line string, name string) bool {
+	lower := strings.ToLower(line)
+	lname := strings.ToLower(name)
+	for start := 0; ; {
+		i := strings.Index(lower[start:], lname)
+		if i == -1 {
+			return false
+		}
+		i += start
+		start = i + 1
+		if i > 0 {
+			if r := rune(lower[i-1]); unicode.IsLetter(r) || unicode.IsDigit(r) {
+				continue
+			}
+		}
+		rest := strings.TrimLeft(lower[i+len(lname):], "\"'")
+		rest = strings.TrimLeft(rest, " \t")
+		if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "=") {
+			return true
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testMetadataSchema = `{"closed": true, "fields": [
+	{"name": "Title", "required": true},
+	{"name": "Owner", "required": true, "pattern": "@[a-z]+"},
+	{"name": "Status", "values": ["draft", "final"]},
+	{"name": "Review-Date", "required": true, "dateFormat": "2006-01-02"},
+	{"name": "Weight", "type": "int"},
+	{"name": "Tags"}
+]}`
+
+func TestValidateMetadata(t *testing.T) {
+	schema, err := ParseMetadataSchema([]byte(testMetadataSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := "Owner: bob\nStatus: wip\nReview-Date: 2024/01/02\nWeight: heavy\nColor: red\n\nBody\n"
+	diags, err := ValidateMetadata([]byte(in), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []MetadataDiagnostic{
+		{Line: 1, Name: "Title", Msg: "required but missing"},
+		{Line: 1, Name: "Owner", Msg: `"bob" does not match "@[a-z]+"`},
+		{Line: 2, Name: "Status", Msg: `"wip" is not one of ["draft" "final"]`},
+		{Line: 3, Name: "Review-Date", Msg: `"2024/01/02" is not a date like "2006-01-02"`},
+		{Line: 4, Name: "Weight", Msg: `"heavy" is not an integer`},
+		{Line: 5, Name: "Color", Msg: "not allowed"},
+	}
+	if !reflect.DeepEqual(diags, exp) {
+		t.Errorf("%#v != %#v", diags, exp)
+	}
+	if s := diags[1].String(); s != `1: Owner: "bob" does not match "@[a-z]+"` {
+		t.Errorf("%#v", s)
+	}
+	in = `---
+title: T
+owner: "@al"
+review-date: 2024-01-02
+tags: [a, b]
+extra:
+  status: x
+---
+Summary here.
+///
+///
+Body
+`
+	diags, _ = ValidateMetadata([]byte(in), schema)
+	exp = []MetadataDiagnostic{
+		{Line: 7, Name: "extra.status", Msg: "not allowed"},
+	}
+	if !reflect.DeepEqual(diags, exp) {
+		t.Errorf("%#v != %#v", diags, exp)
+	}
+	diags, _ = ValidateMetadata([]byte("Title: T\nOwner: @al\nReview-Date: 2024-01-02\n\nSummary here.\n///\nBody\n"), schema)
+	if len(diags) != 0 {
+		t.Errorf("%#v", diags)
+	}
+	diags, _ = ValidateMetadata([]byte("Title: T\nOwner: @al\nReview-Date: 2024-01-02\nbroken line\n"), schema)
+	if len(diags) != 1 || diags[0].Line != 4 {
+		t.Errorf("%#v", diags)
+	}
+}
+
+func TestMetadataItemLines(t *testing.T) {
+	in := "---\ntags:\n- a\n- b\nauthor:\n  name: x\nname: y\n---\n"
+	m, pos := ParseMetadata([]byte(in))
+	lines := metadataItemLines([]byte(in), pos, m)
+	if exp := []int{2, 2, 6, 7}; !reflect.DeepEqual(lines, exp) {
+		t.Errorf("%#v != %#v", lines, exp)
+	}
+}
+
+func TestParseMetadataSchemaErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"fields": [{"name": "A", "pattern": "("}]}`,
+		`{"fields": [{"name": "A", "type": "float"}]}`,
+		`{"fields": `,
+	} {
+		if schema, err := ParseMetadataSchema([]byte(in)); err == nil {
+			t.Errorf("%#v: expected error, got %#v", in, schema)
+		}
+	}
+}
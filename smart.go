@@ -0,0 +1,101 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"unicode"
+	"unicode/utf8"
+)
+
+// smartText returns text with straight quotes replaced by curly quotes, "--"
+// and "---" by en and em dashes, "..." by an ellipsis, and the common
+// fractions and (c), (r) and (tm) by their symbols. The rune before the
+// text, prev, is consulted to decide whether a quote opens or closes.
+func smartText(prev rune, text []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRune(text[i:])
+		rest := text[i:]
+		var next rune = ' '
+		if i+size < len(text) {
+			next, _ = utf8.DecodeRune(text[i+size:])
+		}
+		replacement := ""
+		switch r {
+		case '"':
+			if opensQuote(prev, next) {
+				replacement = "“"
+			} else {
+				replacement = "”"
+			}
+		case '\'':
+			if opensQuote(prev, next) {
+				replacement = "‘"
+			} else {
+				replacement = "’"
+			}
+		case '-':
+			if bytes.HasPrefix(rest, []byte("---")) {
+				replacement, size = "—", 3
+			} else if bytes.HasPrefix(rest, []byte("--")) {
+				replacement, size = "–", 2
+			}
+		case '.':
+			if bytes.HasPrefix(rest, []byte("...")) {
+				replacement, size = "…", 3
+			} else if bytes.HasPrefix(rest, []byte(". . .")) {
+				replacement, size = "…", 5
+			}
+		case '(':
+			for _, s := range []struct{ from, to string }{
+				{"(c)", "©"}, {"(C)", "©"}, {"(r)", "®"}, {"(R)", "®"},
+				{"(tm)", "™"}, {"(TM)", "™"},
+			} {
+				if bytes.HasPrefix(rest, []byte(s.from)) {
+					replacement, size = s.to, len(s.from)
+					break
+				}
+			}
+		case '1', '3':
+			if unicode.IsDigit(prev) || len(rest) < 3 || rest[1] != '/' {
+				break
+			}
+			if len(rest) > 3 && (unicode.IsDigit(rune(rest[3])) || rest[3] == '/') {
+				break
+			}
+			switch string(rest[:3]) {
+			case "1/2":
+				replacement, size = "½", 3
+			case "1/4":
+				replacement, size = "¼", 3
+			case "3/4":
+				replacement, size = "¾", 3
+			}
+		}
+		if replacement == "" {
+			out.Write(text[i : i+size])
+			prev = r
+		} else {
+			out.WriteString(replacement)
+			prev, _ = utf8.DecodeLastRuneInString(replacement)
+		}
+		i += size
+	}
+	return out.Bytes()
+}
+
+// opensQuote returns true if a quote between prev and next should be an
+// opening quote.
+func opensQuote(prev rune, next rune) bool {
+	if unicode.IsSpace(next) && !unicode.IsSpace(prev) {
+		return false
+	}
+	switch prev {
+	case '(', '[', '{', '<', '-', '–', '—', '“', '‘', '/':
+		return true
+	}
+	return unicode.IsSpace(prev)
+}
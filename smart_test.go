@@ -0,0 +1,102 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestSmartPunctuation(t *testing.T) {
+	in := `"Hello," she said -- 'it's *"fine"*'... 1/2 of 3/4 --- not 11/2 (c) ` + "`\"code\" -- ...`" + `
+
+` + "```" + `
+"block" -- ...
+` + "```" + `
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 120}))
+	exp := `"Hello," she said -- 'it's *"fine"*'... 1/2 of 3/4 --- not 11/2 (c) ""code" -- ..."
+
+"block" -- ...
+
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 120, SmartPunctuation: true}))
+	exp = `“Hello,” she said – ‘it’s *“fine”*’… ½ of ¾ — not 11/2 © ""code" -- ..."
+
+"block" -- ...
+
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 120, SmartPunctuation: true, ASCII: true}))
+	exp = `"Hello," she said -- 'it's *"fine"*'... 1/2 of 3/4 --- not 11/2 (c) ""code" -- ..."
+
+"block" -- ...
+
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestSmartPunctuationStarts(t *testing.T) {
+	in := `- "Item"
+- 'two'
+
+> "Quoted"
+
+# "Head"
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, SmartPunctuation: true}))
+	exp := "  * “Item”\n  * ‘two’\n\n> “Quoted”\n\n--[ “Head” ]--\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, SmartPunctuation: true, HeaderPrefix: []byte{}}))
+	exp = "  * “Item”\n  * ‘two’\n\n> “Quoted”\n\n“Head” ]--\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestASCIIOutput(t *testing.T) {
+	in := `Café &mdash; “quoted”
+
+Name | Note
+--- | ---
+Zoë | ½ &copy;
+`
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, Color: true, ASCII: true}))
+	for i := 0; i < len(out); i++ {
+		if out[i] >= 0x80 {
+			t.Fatalf("non-ASCII output %#v", out)
+		}
+	}
+	exp := "Cafe -- \"quoted\"\n\n+------+---------+\n| Name | Note    |\n+------+---------+\n| Zoe  | 1/2 (c) |\n+------+---------+\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestASCIIStructure(t *testing.T) {
+	in := "• not a list\n\n```\ncode\n```\n\n[Zoë](http://example.com/zoë)\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 80, ASCII: true}))
+	exp := "* not a list\n\ncode\n\n[Zoe] http://example.com/zoe\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestSmartPunctuationLinks(t *testing.T) {
+	in := "See http://example.com/a--b...c and [it's...](http://example.com/a--b...c) or [http://example.com/a--b](http://example.com/a--b).\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 200, SmartPunctuation: true}))
+	exp := "See http://example.com/a--b...c and [it’s…] http://example.com/a--b...c or http://example.com/a--b.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
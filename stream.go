@@ -0,0 +1,584 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+// maxStreamSummary is how far into the content Render looks for a summary
+// marker, keeping the content before it for the "Summary" item.
+const maxStreamSummary = 64 * 1024
+
+// Render is the same as MarkdownToTextMetadata only reading the markdown
+// from r and writing the text to w as each top-level block is complete,
+// rather than holding the whole document and its text in memory. If opts
+// is nil the defaults will be used. The error returned is the first from
+// reading r or writing to w.
+//
+// Nothing is written until the metadata is read, up to the first blank line
+// after any front matter. A summary marker is only looked for within the
+// first 64 KiB of content, and as blocks are written before the marker is
+// found, a hard break only drops the last block of the summary from the
+// text. Blocks using reference style links such as "[text][label]" not yet
+// defined are held back, with the blocks after them, until the links are
+// defined or the document ends; those using only "[label]", which may just
+// be bracketed text such as "[TODO]", are held back only until the block
+// after them is complete. With the Footnotes extension nothing is written
+// until the document ends, since the footnotes are numbered and listed
+// there.
+func Render(w io.Writer, r io.Reader, opts *Options) (Metadata, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.ColorMode == ColorModeAuto || opts.ImageProtocol == ImageProtocolAuto {
+		// The text goes to w, which is a terminal only if it is a file
+		// that is one.
+		o := *opts
+		f, ok := w.(*os.File)
+		tty := ok && isTerminal(f)
+		if o.ColorMode == ColorModeAuto {
+			o.ColorMode = DetectColorMode(o.Getenv, tty)
+		}
+		if o.ImageProtocol == ImageProtocolAuto {
+			o.ImageProtocol = detectImageProtocol(o.Getenv, tty)
+		}
+		opts = &o
+	}
+	s := &streamer{
+		in:      bufio.NewReader(r),
+		w:       w,
+		opts:    opts,
+		split:   -1,
+		defined: make(map[string]bool),
+		whole:   resolveOpts(opts).Extensions&blackfriday.Footnotes != 0,
+	}
+	if err := s.header(); err != nil {
+		return NewMetadata(s.metadata), err
+	}
+	err := s.body()
+	return NewMetadata(s.metadata), err
+}
+
+type streamer struct {
+	in       *bufio.Reader
+	w        io.Writer
+	opts     *Options
+	metadata [][]string
+	// pending is read text not yet rendered.
+	pending []byte
+	eof     bool
+	// unresolved are the placeholders already reported.
+	unresolved map[string]bool
+	// state carries the header indentation from block to block.
+	state textState
+	// chunk is the text of the blocks being gathered; fenceOpen is set to
+	// the fence while within a fenced code block.
+	chunk     []byte
+	fenceOpen []byte
+	// htmlClose is set to the closing tag while within a Blackfriday HTML
+	// block, which may contain blank lines; htmlClosed is set once it is
+	// seen, the block ending if a blank line follows.
+	htmlClose  []byte
+	htmlClosed bool
+	// content is set once a line of content has been seen.
+	content bool
+	// summaryText is the content before the first summary marker, while
+	// one is looked for; summaryDone is set once it is no longer, and
+	// afterMarker on the line after the marker, which is a hard break if
+	// it is a marker too.
+	summaryText []byte
+	summaryDone bool
+	afterMarker bool
+	// split is where in chunk a new block may start, depending on the line
+	// after, or -1.
+	split int
+	// definitions are the lines defining reference style links seen so
+	// far, added to each chunk rendered, and defined their labels.
+	definitions []byte
+	defined     map[string]bool
+	// afterDefinition is set if the last line was one of the definitions.
+	afterDefinition bool
+	// held is the text of the blocks held back until the labels they use
+	// are defined, or the document ends if whole is set; heldShortcuts are
+	// those only held until the block after is complete, and done is set at
+	// the end.
+	held          []byte
+	heldLabels    []string
+	heldShortcuts []string
+	whole         bool
+	done          bool
+}
+
+// readLine appends the next line to pending, returning false at the end of
+// the input.
+func (s *streamer) readLine() (bool, error) {
+	if s.eof {
+		return false, nil
+	}
+	line, err := s.in.ReadBytes('\n')
+	s.pending = append(s.pending, line...)
+	if err == io.EOF {
+		s.eof = true
+		return len(line) > 0, nil
+	}
+	return true, err
+}
+
+// header reads and parses the metadata at the start of the document. It
+// reads up to the first blank line outside of any front matter, since
+// MultiMarkdown metadata and Pandoc title blocks end there.
+func (s *streamer) header() error {
+	for {
+		more, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		if len(bytes.TrimSpace(lastLine(s.pending))) == 0 && !frontMatterPending(s.pending) {
+			break
+		}
+	}
+	var pos int
+	s.metadata, pos, _ = parseMetadata(s.pending, false, &Options{NoSummary: true})
+	s.pending = s.pending[pos:]
+	return nil
+}
+
+// frontMatterPending returns true if text starts like front matter that has
+// not yet been closed.
+func frontMatterPending(text []byte) bool {
+	for _, p := range frontMatterParsers {
+		if _, _, ok := p.Split(text); ok {
+			return false
+		}
+	}
+	first, _ := nextLine(text, 0)
+	s := string(first)
+	return s == "---" || s == "+++" || (len(s) > 0 && s[0] == '{')
+}
+
+// summary looks for the first summary marker in the line, adding the
+// "Summary" item once it is found, and returns true if the line is the
+// second marker of a hard break, which drops what of the summary is not yet
+// written.
+func (s *streamer) summary(line []byte) bool {
+	marker := bytes.HasSuffix(line, []byte("\n")) && isSummaryMarker(line[:len(line)-1], s.opts.SummaryMarkers)
+	if s.afterMarker {
+		s.afterMarker = false
+		if !marker {
+			return false
+		}
+		// The content starts again after the break.
+		s.chunk = s.chunk[:0]
+		s.held = nil
+		s.heldLabels = nil
+		s.heldShortcuts = nil
+		s.split = -1
+		s.fenceOpen = nil
+		s.htmlClose = nil
+		s.content = false
+		return true
+	}
+	if s.summaryDone {
+		return false
+	}
+	// As with summaryMarker, a marker must follow a newline.
+	if marker && len(s.summaryText) > 0 {
+		s.metadata = append(s.metadata, []string{"Summary", summaryValue(s.summaryText[:len(s.summaryText)-1], s.metadata, s.opts)})
+		s.summaryText = nil
+		s.summaryDone = true
+		s.afterMarker = true
+		return false
+	}
+	s.summaryText = append(s.summaryText, line...)
+	if len(s.summaryText) > maxStreamSummary {
+		s.summaryText = nil
+		s.summaryDone = true
+	}
+	return false
+}
+
+// body renders the rest of the document a block at a time.
+func (s *streamer) body() error {
+	text := s.pending
+	s.pending = nil
+	for {
+		for len(text) > 0 {
+			line, next := splitLine(text)
+			text = text[next:]
+			if !s.opts.NoSummary && s.summary(line) {
+				continue
+			}
+			if err := s.line(line); err != nil {
+				return err
+			}
+		}
+		if s.eof {
+			break
+		}
+		more, err := s.readLine()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+		text = s.pending
+		s.pending = s.pending[:0]
+	}
+	if s.split != -1 {
+		if err := s.flush(s.split); err != nil {
+			return err
+		}
+	}
+	s.done = true
+	return s.flush(len(s.chunk))
+}
+
+// splitLine returns the first line of text, including its newline, and the
+// position after it.
+func splitLine(text []byte) ([]byte, int) {
+	if i := bytes.IndexByte(text, '\n'); i != -1 {
+		return text[:i+1], i + 1
+	}
+	return text, len(text)
+}
+
+// line adds a line of content, rendering the blocks gathered so far once a
+// line is known to start a new top-level block.
+func (s *streamer) line(line []byte) error {
+	afterDefinition := s.afterDefinition
+	s.afterDefinition = false
+	trimmed := bytes.TrimLeft(line, " \t")
+	indent := 0
+	for _, c := range line[:len(line)-len(trimmed)] {
+		if c == '\t' {
+			indent += 4 - indent%4
+		} else {
+			indent++
+		}
+	}
+	if s.split != -1 {
+		// A definition continues a definition list rather than starting a
+		// new block with its term.
+		if len(trimmed) < 2 || trimmed[0] != ':' || (trimmed[1] != ' ' && trimmed[1] != '\t') {
+			if err := s.flush(s.split); err != nil {
+				return err
+			}
+		}
+		s.split = -1
+	}
+	if s.fenceOpen != nil {
+		if indent < 4 && bytes.HasPrefix(trimmed, s.fenceOpen) && len(bytes.Trim(trimmed, string(s.fenceOpen[:1])+" \t\r\n")) == 0 {
+			s.fenceOpen = nil
+		}
+		s.chunk = append(s.chunk, line...)
+		return nil
+	}
+	// As with stripSummaryMarkers, a marker must follow a newline and end
+	// with one.
+	first := !s.content
+	s.content = true
+	if !s.opts.NoSummary && !first && bytes.HasSuffix(line, []byte("\n")) && isSummaryMarker(line[:len(line)-1], s.opts.SummaryMarkers) {
+		return nil
+	}
+	if s.htmlClose != nil {
+		// As Blackfriday does, the block ends with a line ending with the
+		// closing tag followed by a blank line.
+		blank := len(bytes.TrimSpace(line)) == 0
+		if s.htmlClosed && blank {
+			s.htmlClose = nil
+		} else if !blank {
+			s.htmlClosed = bytes.HasSuffix(bytes.TrimRight(line, " \t\r\n"), s.htmlClose)
+		}
+		s.chunk = append(s.chunk, line...)
+		return nil
+	}
+	if indent == 0 && len(bytes.TrimSpace(trimmed)) > 0 && startsTopLevelBlock(trimmed) && endsWithBlankLine(s.chunk) {
+		s.split = len(s.chunk)
+	}
+	if indent == 0 {
+		// Blocks are not split within an HTML block, which may start any
+		// line.
+		if tag := htmlBlockTag(line); tag != "" {
+			s.htmlClose = []byte("</" + tag + ">")
+			s.htmlClosed = bytes.HasSuffix(bytes.TrimRight(line, " \t\r\n"), s.htmlClose)
+		}
+	}
+	// Definitions cannot continue a paragraph.
+	if indent < 4 && (afterDefinition || len(bytes.TrimSpace(lastLine(s.chunk))) == 0) {
+		if label, ok := linkDefinition(trimmed); ok {
+			s.definitions = append(s.definitions, trimmed...)
+			if !bytes.HasSuffix(trimmed, []byte("\n")) {
+				s.definitions = append(s.definitions, '\n')
+			}
+			s.defined[label] = true
+			s.afterDefinition = true
+		}
+	}
+	if indent < 4 && (bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~"))) {
+		fence := trimmed[:3]
+		for len(fence) < len(trimmed) && trimmed[len(fence)] == fence[0] {
+			fence = trimmed[:len(fence)+1]
+		}
+		s.fenceOpen = append([]byte(nil), fence...)
+	}
+	s.chunk = append(s.chunk, line...)
+	return nil
+}
+
+// startsTopLevelBlock returns true if a line, not indented and following a
+// blank line, starts a new block rather than continuing a list or
+// definition list.
+func startsTopLevelBlock(line []byte) bool {
+	switch line[0] {
+	case '*', '-', '+', ':':
+		return len(line) > 1 && line[1] != ' ' && line[1] != '\t'
+	}
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	return i == 0 || i+1 >= len(line) || line[i] != '.' || (line[i+1] != ' ' && line[i+1] != '\t')
+}
+
+// endsWithBlankLine returns true if text has some content and ends with a
+// blank line.
+func endsWithBlankLine(text []byte) bool {
+	if len(bytes.TrimSpace(text)) == 0 || !bytes.HasSuffix(text, []byte("\n")) {
+		return false
+	}
+	return len(bytes.TrimSpace(lastLine(text))) == 0
+}
+
+// flush renders the blocks gathered before end and writes them, unless they
+// are to be held back. Once a block other than link definitions is complete,
+// the "[label]" uses of the blocks before it no longer hold them back.
+func (s *streamer) flush(end int) error {
+	block := s.chunk[:end]
+	if !definitionsOnly(block) {
+		s.heldShortcuts = nil
+	}
+	labels, shortcuts := referenceLabels(block)
+	s.held = append(s.held, block...)
+	s.heldLabels = append(s.heldLabels, labels...)
+	s.heldShortcuts = append(s.heldShortcuts, shortcuts...)
+	s.chunk = append(s.chunk[:0], s.chunk[end:]...)
+	if !s.done {
+		if s.whole {
+			return nil
+		}
+		for _, labels := range [][]string{s.heldLabels, s.heldShortcuts} {
+			for _, label := range labels {
+				if !s.defined[label] {
+					return nil
+				}
+			}
+		}
+	}
+	chunk := s.held
+	s.held = nil
+	s.heldLabels = nil
+	s.heldShortcuts = nil
+	if len(bytes.TrimSpace(chunk)) == 0 {
+		return nil
+	}
+	if len(s.definitions) > 0 && !s.whole && s.fenceOpen == nil {
+		// The links may be used in this chunk but defined in one before.
+		if !bytes.HasSuffix(chunk, []byte("\n")) {
+			chunk = append(chunk, '\n')
+		}
+		chunk = append(append(chunk, '\n'), s.definitions...)
+	}
+	opts := *s.opts
+	if opts.UnresolvedVariable != nil {
+		if s.unresolved == nil {
+			s.unresolved = make(map[string]bool)
+		}
+		report := s.opts.UnresolvedVariable
+		opts.UnresolvedVariable = func(name string) {
+			if !s.unresolved[name] {
+				s.unresolved[name] = true
+				report(name)
+			}
+		}
+	}
+	// Marker lines were already dropped.
+	opts.NoSummary = true
+	text := markdownToText(chunk, NewMetadata(s.metadata), &opts, &s.state)
+	if len(text) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(text)
+	return err
+}
+
+// lastLine returns the last line of text, without its newline.
+func lastLine(text []byte) []byte {
+	text = bytes.TrimSuffix(text, []byte("\n"))
+	if i := bytes.LastIndexByte(text, '\n'); i != -1 {
+		return text[i+1:]
+	}
+	return text
+}
+
+// htmlBlockTag returns the name of the tag starting the line if it starts a
+// Blackfriday HTML block, or "" if it does not.
+func htmlBlockTag(line []byte) string {
+	if len(line) < 2 || line[0] != '<' {
+		return ""
+	}
+	i := 1
+	for i < len(line) && (line[i] >= 'a' && line[i] <= 'z' || line[i] >= 'A' && line[i] <= 'Z' || line[i] >= '0' && line[i] <= '9') {
+		i++
+	}
+	if i == len(line) || (line[i] != '>' && line[i] != ' ' && line[i] != '\t' && line[i] != '\n' && line[i] != '\r') {
+		return ""
+	}
+	if tag := string(line[1:i]); htmlBlockTags[tag] {
+		return tag
+	}
+	return ""
+}
+
+// htmlBlockTags are the tags Blackfriday starts HTML blocks with.
+var htmlBlockTags = map[string]bool{}
+
+func init() {
+	for _, tag := range strings.Fields(`address article aside blockquote canvas
+		del div dl fieldset figcaption figure footer form h1 h2 h3 h4 h5 h6
+		header hgroup iframe ins main math nav noscript ol output p pre
+		progress script section style table ul video`) {
+		htmlBlockTags[tag] = true
+	}
+}
+
+// linkDefinition returns the normalized label of the reference style link
+// the line, without its indentation, defines, if it defines one.
+func linkDefinition(line []byte) (string, bool) {
+	if len(line) == 0 || line[0] != '[' {
+		return "", false
+	}
+	end := bytes.IndexByte(line, ']')
+	if end < 2 || end+1 >= len(line) || line[end+1] != ':' || len(bytes.TrimSpace(line[end+2:])) == 0 {
+		return "", false
+	}
+	return normalizeLabel(line[1:end]), true
+}
+
+// definitionsOnly returns true if every line of text that is not blank
+// defines a reference style link.
+func definitionsOnly(text []byte) bool {
+	for len(text) > 0 {
+		line, next := splitLine(text)
+		text = text[next:]
+		trimmed := bytes.TrimLeft(line, " ")
+		if _, ok := linkDefinition(trimmed); !ok && len(bytes.TrimSpace(trimmed)) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// referenceLabels returns the normalized labels of what may be reference
+// style links in text, outside of code blocks and spans: any bracketed
+// text not followed by a parenthesized URL or starting a definition. Those
+// of shortcut references, just "[label]", are returned on their own.
+func referenceLabels(text []byte) ([]string, []string) {
+	var labels, shortcuts []string
+	var fence []byte
+	for len(text) > 0 {
+		line, next := splitLine(text)
+		text = text[next:]
+		trimmed := bytes.TrimLeft(line, " ")
+		if fence != nil {
+			if bytes.HasPrefix(trimmed, fence) {
+				fence = nil
+			}
+			continue
+		}
+		if len(line)-len(trimmed) >= 4 || len(trimmed) > 0 && trimmed[0] == '\t' {
+			continue
+		}
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fence = trimmed[:3]
+			continue
+		}
+		if _, ok := linkDefinition(trimmed); ok {
+			continue
+		}
+		l, sc := lineReferenceLabels(line)
+		labels = append(labels, l...)
+		shortcuts = append(shortcuts, sc...)
+	}
+	return labels, shortcuts
+}
+
+// lineReferenceLabels returns the labels of what may be reference style
+// links in the line, as referenceLabels does.
+func lineReferenceLabels(line []byte) ([]string, []string) {
+	var labels, shortcuts []string
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '`':
+			// Skip the code span.
+			n := 1
+			for i+n < len(line) && line[i+n] == '`' {
+				n++
+			}
+			if end := bytes.Index(line[i+n:], line[i:i+n]); end != -1 {
+				i += n + end + n - 1
+			} else {
+				i += n - 1
+			}
+		case '[':
+			end := bytes.IndexByte(line[i+1:], ']')
+			if end == -1 {
+				return labels, shortcuts
+			}
+			label := line[i+1 : i+1+end]
+			i += end + 1
+			if i+1 < len(line) && line[i+1] == '(' {
+				continue
+			}
+			shortcut := true
+			if i+1 < len(line) && line[i+1] == '[' {
+				if end := bytes.IndexByte(line[i+2:], ']'); end != -1 {
+					if end > 0 {
+						label = line[i+2 : i+2+end]
+					}
+					i += end + 2
+					shortcut = false
+				}
+			}
+			if len(bytes.TrimSpace(label)) == 0 {
+				continue
+			}
+			if shortcut {
+				shortcuts = append(shortcuts, normalizeLabel(label))
+			} else {
+				labels = append(labels, normalizeLabel(label))
+			}
+		}
+	}
+	return labels, shortcuts
+}
+
+// normalizeLabel returns the form of a link label used to match uses and
+// definitions, which ignores case and runs of spaces.
+func normalizeLabel(label []byte) string {
+	return strings.ToLower(strings.Join(strings.Fields(string(label)), " "))
+}
@@ -0,0 +1,286 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+var testRenderDocuments = []string{
+	`Title: Test
+Author: One
+
+Intro paragraph with *emphasis*.
+///
+
+# One
+
+Para under one.
+
+* item a
+* item b
+
+    continued in b
+
+* item c
+  1. nested
+  2. nested two
+
+Term
+: Definition
+
+Other
+: Definition
+
+> quote line
+> more
+
+| a | b |
+|---|---|
+| 1 | 2 |
+
+## Two
+
+` + "```" + `go
+func x() {
+
+}
+` + "```" + `
+
+<div>
+
+html block
+
+</div>
+
+---
+
+### Three
+
+1. first
+
+2. second
+
+Final [link][r].
+[r]: http://example.com
+`,
+	`% The Title
+% Author
+
+Line with trailing
+break
+
+	tab indented code
+
+	more code
+
+///
+
+Setext
+======
+text right after
+`,
+	`---
+title: Front
+---
+///
+///
+After a hard break.
+`,
+	"Text[^1].\n\n[^1]: Note.\n",
+	"See [r].\n\nMore.\n\n[r]: http://example.com\n",
+	"See [TODO] and [x][r].\n\nMore.\n\nEnd.\n\n[r]: http://example.com\n",
+	"The\nsummary.\n///\n///\nBody.\n\n///\n",
+	"<details>\n<summary>More</summary>\n\nHidden *text*.\n\n</details>\n\nAfter.\n",
+	"<ul>\n<li>one</li>\n\n<li>two</li>\n</ul>\n\nAfter.\n",
+	"",
+	"No newline at the end",
+}
+
+func TestRender(t *testing.T) {
+	for _, opts := range []*Options{
+		nil,
+		{Width: 40, Color: true},
+		{Width: 60, HeaderPrefix: []byte("#"), Indent1: []byte("  "), Indent2: []byte("  ")},
+		{HTML: HTMLRender},
+		{Extensions: DefaultExtensions | blackfriday.Footnotes},
+		{Parser: ParserCommonMark},
+	} {
+		for _, in := range testRenderDocuments {
+			expMetadata, exp := MarkdownToTextMetadata([]byte(in), opts)
+			var out bytes.Buffer
+			metadata, err := Render(&out, strings.NewReader(in), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(metadata, expMetadata) {
+				t.Errorf("%#v != %#v", metadata, expMetadata)
+			}
+			if out.String() != string(exp) {
+				t.Errorf("%#v != %#v", out.String(), string(exp))
+			}
+		}
+	}
+}
+
+func TestRenderFootnotes(t *testing.T) {
+	var out bytes.Buffer
+	_, err := Render(&out, strings.NewReader("Text[^1].\n\n[^1]: Note.\n"), &Options{Extensions: DefaultExtensions | blackfriday.Footnotes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "Text[1].\n\n[1] Note.\n"
+	if out.String() != exp {
+		t.Errorf("%#v != %#v", out.String(), exp)
+	}
+}
+
+func TestRenderColorModeAuto(t *testing.T) {
+	// os.Stdout as a character device counts as a terminal, but the text
+	// goes to a buffer, which is not one.
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer null.Close()
+	stdout := os.Stdout
+	os.Stdout = null
+	defer func() { os.Stdout = stdout }()
+	getenv := func(k string) string {
+		return map[string]string{"TERM": "xterm-256color"}[k]
+	}
+	var out bytes.Buffer
+	_, err = Render(&out, strings.NewReader("# Head\n"), &Options{Width: 80, ColorMode: ColorModeAuto, Getenv: getenv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "--[ Head ]--\n\n"
+	if out.String() != exp {
+		t.Errorf("%#v != %#v", out.String(), exp)
+	}
+}
+
+// notifyWriter signals each write to it.
+type notifyWriter struct {
+	bytes.Buffer
+	written chan string
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	n, err := w.Buffer.Write(p)
+	w.written <- string(p)
+	return n, err
+}
+
+func TestRenderStreams(t *testing.T) {
+	r, w := io.Pipe()
+	out := &notifyWriter{written: make(chan string, 10)}
+	errs := make(chan error)
+	var metadata Metadata
+	go func() {
+		var err error
+		metadata, err = Render(out, r, nil)
+		errs <- err
+	}()
+	// A block is written once the line after the start of the next shows
+	// it is not a definition continuing a definition list, other than one
+	// using "[label]", which waits for the block after it.
+	var in string
+	for _, step := range [][2]string{
+		{"# One\n\nFirst.\n", ""},
+		{"\n", "--[ One ]--\n\n"},
+		{"///\n", ""},
+		{"Second [TODO]\n", ""},
+		{"line.\n", "    First.\n"},
+		{"\nThird\n", ""},
+		{"line.\n", ""},
+		{"\nFourth.\n", ""},
+		{"\n", "\n    Second [TODO] line.\n\n    Third line.\n"},
+	} {
+		in += step[0]
+		w.Write([]byte(step[0]))
+		if step[1] == "" {
+			continue
+		}
+		select {
+		case text := <-out.written:
+			if text != step[1] {
+				t.Errorf("%#v != %#v", text, step[1])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%#v not written", step[1])
+		}
+	}
+	w.Close()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	expMetadata, exp := MarkdownToTextMetadata([]byte(in), nil)
+	if out.String() != string(exp) {
+		t.Errorf("%#v != %#v", out.String(), string(exp))
+	}
+	if !reflect.DeepEqual(metadata, expMetadata) {
+		t.Errorf("%#v != %#v", metadata, expMetadata)
+	}
+}
+
+func TestRenderVariables(t *testing.T) {
+	var unresolved []string
+	opts := &Options{
+		ExpandVariables:    true,
+		UnresolvedVariable: func(name string) { unresolved = append(unresolved, name) },
+	}
+	var out bytes.Buffer
+	if _, err := Render(&out, strings.NewReader("Name: Bob\n\nHi {{Name}} {{missing}}.\n\nBye {{missing}}.\n"), opts); err != nil {
+		t.Fatal(err)
+	}
+	exp := "Hi Bob {{missing}}.\n\nBye {{missing}}.\n"
+	if out.String() != exp {
+		t.Errorf("%#v != %#v", out.String(), exp)
+	}
+	if !reflect.DeepEqual(unresolved, []string{"missing"}) {
+		t.Errorf("%#v != %#v", unresolved, []string{"missing"})
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestRenderWriteError(t *testing.T) {
+	metadata, err := Render(errWriter{}, strings.NewReader("Title: Test\n\nOne.\n\nTwo.\n"), nil)
+	if err == nil || err.Error() != "write failed" {
+		t.Errorf("%#v", err)
+	}
+	if title, _ := metadata.Get("Title"); title != "Test" {
+		t.Errorf("%#v != %#v", title, "Test")
+	}
+}
+
+func TestRenderReadError(t *testing.T) {
+	r := io.MultiReader(strings.NewReader("One.\n\nTwo.\n\n"), &errReader{})
+	var out bytes.Buffer
+	_, err := Render(&out, r, nil)
+	if err == nil || err.Error() != "read failed" {
+		t.Errorf("%#v", err)
+	}
+}
+
+type errReader struct{}
+
+func (*errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
@@ -0,0 +1,323 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Color is a terminal color: the terminal's default, one of the 16 ANSI
+// colors, one of the 256 color palette, or a 24-bit RGB color.
+type Color uint32
+
+const (
+	colorKindMask    Color = 0xff000000
+	colorKind16      Color = 0x01000000
+	colorKind256     Color = 0x02000000
+	colorKindRGB     Color = 0x03000000
+	colorValueMask   Color = 0x00ffffff
+	colorPaletteMask Color = 0x000000ff
+)
+
+const (
+	// ColorDefault is the terminal's default color.
+	ColorDefault Color = 0
+	// ColorBlack through ColorWhite are the first 8 ANSI colors.
+	ColorBlack   Color = colorKind16 | 0
+	ColorRed     Color = colorKind16 | 1
+	ColorGreen   Color = colorKind16 | 2
+	ColorYellow  Color = colorKind16 | 3
+	ColorBlue    Color = colorKind16 | 4
+	ColorMagenta Color = colorKind16 | 5
+	ColorCyan    Color = colorKind16 | 6
+	ColorWhite   Color = colorKind16 | 7
+	// ColorBrightBlack through ColorBrightWhite are the bright versions of
+	// the first 8, the rest of the 16 ANSI colors.
+	ColorBrightBlack   Color = colorKind16 | 8
+	ColorBrightRed     Color = colorKind16 | 9
+	ColorBrightGreen   Color = colorKind16 | 10
+	ColorBrightYellow  Color = colorKind16 | 11
+	ColorBrightBlue    Color = colorKind16 | 12
+	ColorBrightMagenta Color = colorKind16 | 13
+	ColorBrightCyan    Color = colorKind16 | 14
+	ColorBrightWhite   Color = colorKind16 | 15
+)
+
+// ANSIColor returns the ANSI color of the index, 0 through 15.
+func ANSIColor(index uint8) Color {
+	return colorKind16 | Color(index&15)
+}
+
+// PaletteColor returns the color of the index in the 256 color palette.
+func PaletteColor(index uint8) Color {
+	return colorKind256 | Color(index)
+}
+
+// RGBColor returns the 24-bit color of the red, green and blue values.
+func RGBColor(r uint8, g uint8, b uint8) Color {
+	return colorKindRGB | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// params appends the SGR parameters selecting the color, base being 30 for
+// the foreground or 40 for the background.
+func (c Color) params(params []string, base int) []string {
+	switch c & colorKindMask {
+	case colorKind16:
+		i := int(c & colorPaletteMask)
+		if i < 8 {
+			return append(params, strconv.Itoa(base+i))
+		}
+		return append(params, strconv.Itoa(base+60+i-8))
+	case colorKind256:
+		return append(params, strconv.Itoa(base+8), "5", strconv.Itoa(int(c&colorPaletteMask)))
+	case colorKindRGB:
+		v := c & colorValueMask
+		return append(params, strconv.Itoa(base+8), "2", strconv.Itoa(int(v>>16)), strconv.Itoa(int(v>>8&0xff)), strconv.Itoa(int(v&0xff)))
+	}
+	return append(params, strconv.Itoa(base+9))
+}
+
+// Underline is how text is underlined.
+type Underline int
+
+const (
+	// UnderlineNone is not underlined.
+	UnderlineNone Underline = iota
+	// UnderlineSingle is underlined with a single straight line.
+	UnderlineSingle
+	// UnderlineDouble is underlined with a double line.
+	UnderlineDouble
+	// UnderlineCurly is underlined with a wavy line, where supported.
+	UnderlineCurly
+	// UnderlineDotted is underlined with a dotted line, where supported.
+	UnderlineDotted
+	// UnderlineDashed is underlined with a dashed line, where supported.
+	UnderlineDashed
+)
+
+// Style is how text is shown on a terminal, encoded as ANSI Select Graphic
+// Rendition escape sequences. The zero Style is the terminal's default.
+type Style struct {
+	// Foreground and Background are the text and background colors.
+	Foreground Color
+	Background Color
+	Bold       bool
+	Dim        bool
+	Italic     bool
+	Underline  Underline
+	// Strikethrough set true draws a line through the text.
+	Strikethrough bool
+	// Reverse set true swaps the foreground and background colors.
+	Reverse bool
+	// Raw is output as it is after any escape sequence for the rest of the
+	// style, for effects Style cannot describe; once text styled with Raw
+	// ends, the style is reset entirely and the enclosing style restored.
+	Raw []byte
+}
+
+// defaultStyles are those of the elements unless the Options say
+// otherwise.
+var defaultStyles = map[Element]Style{
+	ElementHeader:         {Bold: true},
+	ElementLink:           {Foreground: ColorBlue},
+	ElementImage:          {Foreground: ColorMagenta},
+	ElementCodeSpan:       {Foreground: ColorGreen},
+	ElementBlockCode:      {Foreground: ColorGreen},
+	ElementStrikethrough:  {Foreground: ColorWhite},
+	ElementEmphasis:       {Foreground: ColorYellow},
+	ElementDoubleEmphasis: {Bold: true},
+	ElementTripleEmphasis: {Bold: true, Foreground: ColorRed},
+}
+
+// resetSGR resets all attributes to the terminal's defaults.
+var resetSGR = []byte("\x1b[0m")
+
+// IsZero returns true if the style is the terminal's default.
+func (s Style) IsZero() bool {
+	return s.attrs() == (Style{}).attrs() && len(s.Raw) == 0
+}
+
+// attrs returns the style without Raw, so it may be compared.
+func (s Style) attrs() styleAttrs {
+	return styleAttrs{s.Foreground, s.Background, s.Bold, s.Dim, s.Italic, s.Underline, s.Strikethrough, s.Reverse}
+}
+
+type styleAttrs struct {
+	foreground    Color
+	background    Color
+	bold          bool
+	dim           bool
+	italic        bool
+	underline     Underline
+	strikethrough bool
+	reverse       bool
+}
+
+// Inside returns the style of text styled as s within text styled as
+// outer: colors s leaves as the default are those of outer and attributes
+// of either are set.
+func (s Style) Inside(outer Style) Style {
+	if s.Foreground == ColorDefault {
+		s.Foreground = outer.Foreground
+	}
+	if s.Background == ColorDefault {
+		s.Background = outer.Background
+	}
+	s.Bold = s.Bold || outer.Bold
+	s.Dim = s.Dim || outer.Dim
+	s.Italic = s.Italic || outer.Italic
+	if s.Underline == UnderlineNone {
+		s.Underline = outer.Underline
+	}
+	s.Strikethrough = s.Strikethrough || outer.Strikethrough
+	s.Reverse = s.Reverse || outer.Reverse
+	if len(outer.Raw) > 0 {
+		s.Raw = append(append([]byte(nil), outer.Raw...), s.Raw...)
+	}
+	return s
+}
+
+// SGR returns the shortest escape sequence changing text styled as from to
+// the style; nothing if they are the same.
+func (s Style) SGR(from Style) []byte {
+	return encodeStyle(from, s, resetSGR)
+}
+
+// encodeStyle returns what changes text styled as from to the style to,
+// with reset resetting the style entirely.
+func encodeStyle(from Style, to Style, reset []byte) []byte {
+	if len(from.Raw) > 0 {
+		if from.attrs() == to.attrs() && bytes.HasPrefix(to.Raw, from.Raw) {
+			return append([]byte(nil), to.Raw[len(from.Raw):]...)
+		}
+		// Whatever Raw did can only be undone by a reset.
+		b := append([]byte(nil), reset...)
+		b = append(b, sgr(to.attrs().params(nil))...)
+		return append(b, to.Raw...)
+	}
+	if len(to.Raw) > 0 {
+		return append(sgr(from.attrs().change(to.attrs())), to.Raw...)
+	}
+	if from.attrs() == to.attrs() {
+		return nil
+	}
+	if to.IsZero() {
+		return append([]byte(nil), reset...)
+	}
+	return sgr(from.attrs().change(to.attrs()))
+}
+
+// sgr returns the escape sequence of the parameters, if any.
+func sgr(params []string) []byte {
+	if len(params) == 0 {
+		return nil
+	}
+	b := []byte("\x1b[")
+	for i, p := range params {
+		if i > 0 {
+			b = append(b, ';')
+		}
+		b = append(b, p...)
+	}
+	return append(b, 'm')
+}
+
+// params appends the SGR parameters setting the attributes, from the
+// terminal's default.
+func (a styleAttrs) params(params []string) []string {
+	if a.bold {
+		params = append(params, "1")
+	}
+	if a.dim {
+		params = append(params, "2")
+	}
+	if a.italic {
+		params = append(params, "3")
+	}
+	switch a.underline {
+	case UnderlineSingle:
+		params = append(params, "4")
+	case UnderlineDouble:
+		params = append(params, "4:2")
+	case UnderlineCurly:
+		params = append(params, "4:3")
+	case UnderlineDotted:
+		params = append(params, "4:4")
+	case UnderlineDashed:
+		params = append(params, "4:5")
+	}
+	if a.reverse {
+		params = append(params, "7")
+	}
+	if a.strikethrough {
+		params = append(params, "9")
+	}
+	if a.foreground != ColorDefault {
+		params = a.foreground.params(params, 30)
+	}
+	if a.background != ColorDefault {
+		params = a.background.params(params, 40)
+	}
+	return params
+}
+
+// change returns the SGR parameters changing the attributes to those of
+// to: either each that differs or, if shorter, a reset and all of them.
+func (a styleAttrs) change(to styleAttrs) []string {
+	var params []string
+	from := a
+	if (from.bold && !to.bold) || (from.dim && !to.dim) {
+		// Normal intensity ends both bold and dim.
+		params = append(params, "22")
+		from.bold = false
+		from.dim = false
+	}
+	if from.italic && !to.italic {
+		params = append(params, "23")
+		from.italic = false
+	}
+	if from.underline != UnderlineNone && to.underline == UnderlineNone {
+		params = append(params, "24")
+		from.underline = UnderlineNone
+	}
+	if from.reverse && !to.reverse {
+		params = append(params, "27")
+		from.reverse = false
+	}
+	if from.strikethrough && !to.strikethrough {
+		params = append(params, "29")
+		from.strikethrough = false
+	}
+	var set styleAttrs
+	set.bold = to.bold && !from.bold
+	set.dim = to.dim && !from.dim
+	set.italic = to.italic && !from.italic
+	if to.underline != from.underline {
+		set.underline = to.underline
+	}
+	set.reverse = to.reverse && !from.reverse
+	set.strikethrough = to.strikethrough && !from.strikethrough
+	params = set.params(params)
+	if to.foreground != from.foreground {
+		params = to.foreground.params(params, 30)
+	}
+	if to.background != from.background {
+		params = to.background.params(params, 40)
+	}
+	if reset := to.params([]string{"0"}); paramsLen(reset) < paramsLen(params) {
+		return reset
+	}
+	return params
+}
+
+// paramsLen returns the length of the parameters once encoded.
+func paramsLen(params []string) int {
+	n := 0
+	for _, p := range params {
+		n += len(p) + 1
+	}
+	return n
+}
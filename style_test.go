@@ -0,0 +1,105 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"testing"
+)
+
+func TestStyleSGR(t *testing.T) {
+	for _, c := range []struct {
+		from Style
+		to   Style
+		exp  string
+	}{
+		{Style{}, Style{}, ""},
+		{Style{}, Style{Bold: true}, "\x1b[1m"},
+		{Style{Bold: true}, Style{}, "\x1b[0m"},
+		{Style{Bold: true, Foreground: ColorYellow}, Style{Bold: true}, "\x1b[39m"},
+		{Style{Bold: true}, Style{Bold: true, Foreground: ColorRed}, "\x1b[31m"},
+		{Style{Bold: true}, Style{Dim: true}, "\x1b[0;2m"},
+		{Style{Italic: true, Underline: UnderlineSingle, Foreground: ColorRed}, Style{Foreground: ColorBlue}, "\x1b[0;34m"},
+		{Style{}, Style{Foreground: ColorBrightRed, Background: ColorBrightBlack}, "\x1b[91;100m"},
+		{Style{}, Style{Foreground: PaletteColor(208)}, "\x1b[38;5;208m"},
+		{Style{}, Style{Background: RGBColor(1, 2, 3)}, "\x1b[48;2;1;2;3m"},
+		{Style{}, Style{Underline: UnderlineCurly, Strikethrough: true, Reverse: true}, "\x1b[4:3;7;9m"},
+		{Style{Reverse: true, Strikethrough: true}, Style{Strikethrough: true}, "\x1b[27m"},
+		{Style{}, Style{Raw: []byte("<x>")}, "<x>"},
+		{Style{Bold: true}, Style{Bold: true, Raw: []byte("<x>")}, "<x>"},
+		{Style{Raw: []byte("<x>")}, Style{Raw: []byte("<x><y>")}, "<y>"},
+		{Style{Raw: []byte("<x><y>")}, Style{Raw: []byte("<x>")}, "\x1b[0m<x>"},
+		{Style{Bold: true, Raw: []byte("<x>")}, Style{Bold: true}, "\x1b[0m\x1b[1m"},
+	} {
+		out := string(c.to.SGR(c.from))
+		if out != c.exp {
+			t.Errorf("%#v to %#v: %#v != %#v", c.from, c.to, out, c.exp)
+		}
+	}
+}
+
+func TestStyleInside(t *testing.T) {
+	out := Style{Foreground: ColorYellow, Italic: true}.Inside(Style{Foreground: ColorBlue, Background: ColorWhite, Bold: true})
+	exp := Style{Foreground: ColorYellow, Background: ColorWhite, Bold: true, Italic: true}
+	if out.attrs() != exp.attrs() || out.Raw != nil {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestStyles(t *testing.T) {
+	in := "## Install **now** please\n\n[a `code` link](http://x)\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:        80,
+		Color:        true,
+		HeaderPrefix: []byte{},
+		HeaderSuffix: []byte{},
+		Styles: map[Element]Style{
+			ElementHeader:         {Foreground: ColorCyan, Underline: UnderlineSingle},
+			ElementDoubleEmphasis: {Bold: true},
+		},
+	}))
+	exp := "\x1b[4;36mInstall \x1b[1mnow\x1b[22m please\x1b[0m\n\n        \x1b[34m[a \x1b[32mcode\x1b[34m link] http://x\x1b[0m\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestStylesRaw(t *testing.T) {
+	in := "# Head *em* more\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{
+		Width:         80,
+		Color:         true,
+		ColorHeader:   []byte("<h>"),
+		ColorEmphasis: []byte("<em>"),
+		ColorReset:    []byte("<reset>"),
+	}))
+	exp := "--[ <h>Head <em>em<reset><h> more<reset> ]--\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestStylesWrap(t *testing.T) {
+	in := "# A heading with [a link that is long enough to wrap](http://example.com/path)\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30, Color: true}))
+	exp := "--[ \x1b[1mA heading with \x1b[34m[a link\x1b[0m\n    \x1b[1;34mthat is long enough to\x1b[0m\n    \x1b[1;34mwrap]\x1b[0m\n    \x1b[1;34mhttp://example.com/path\x1b[0m ]--\n\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestStylesTable(t *testing.T) {
+	in := "| a | b |\n|---|---|\n| **bold words that wrap in the cell** | x |\n"
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30, Color: true}))
+	exp := "╔══════════════════════╦═══╗\n║ a                    ║ b ║\n╠══════════════════════╬═══╣\n║ \x1b[1mbold words that wrap\x1b[0m ║ x ║\n║ \x1b[1min the cell\x1b[0m          ║   ║\n╚══════════════════════╩═══╝\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	in = "| a | b |\n|---|---|\n| 1 | [see `code` here](http://x.com) and *more text* |\n"
+	out = string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 30, Color: true}))
+	exp = "╔═══╦═══════════════════════╗\n║ a ║ b                     ║\n╠═══╬═══════════════════════╣\n║ 1 ║ \x1b[34m[see \x1b[32mcode\x1b[34m here]\x1b[0m       ║\n║   ║ \x1b[34mhttp://x.com\x1b[0m and \x1b[33mmore\x1b[0m ║\n║   ║ \x1b[33mtext\x1b[0m                  ║\n╚═══╩═══════════════════════╝\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
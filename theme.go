@@ -0,0 +1,340 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Theme is the styles of the elements, for Options.Styles; elements it
+// leaves out have their default style.
+type Theme map[Element]Style
+
+// elementNames are the names of the elements in theme files.
+var elementNames = [...]string{
+	ElementHeader:         "header",
+	ElementLink:           "link",
+	ElementImage:          "image",
+	ElementCodeSpan:       "code-span",
+	ElementBlockCode:      "block-code",
+	ElementStrikethrough:  "strikethrough",
+	ElementEmphasis:       "emphasis",
+	ElementDoubleEmphasis: "double-emphasis",
+	ElementTripleEmphasis: "triple-emphasis",
+	ElementHeader1:        "header1",
+	ElementHeader2:        "header2",
+	ElementHeader3:        "header3",
+	ElementHeader4:        "header4",
+	ElementHeader5:        "header5",
+	ElementHeader6:        "header6",
+	ElementBlockQuote:     "block-quote",
+	ElementTableHeader:    "table-header",
+	ElementTableBorder:    "table-border",
+	ElementCodeKeyword:    "code-keyword",
+	ElementCodeString:     "code-string",
+	ElementCodeComment:    "code-comment",
+	ElementCodeNumber:     "code-number",
+	ElementMetadataName:   "metadata-name",
+	ElementMetadataValue:  "metadata-value",
+}
+
+// String returns the name of the element in theme files, such as
+// "double-emphasis".
+func (e Element) String() string {
+	if e >= 0 && int(e) < len(elementNames) {
+		return elementNames[e]
+	}
+	return "Element(" + strconv.Itoa(int(e)) + ")"
+}
+
+// colorNames are the names of the 8 ANSI colors in theme files, each
+// prefixed with "bright-" for its bright version.
+var colorNames = [...]string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// solarized are the colors of Ethan Schoonover's Solarized palette.
+var (
+	solarizedBase01  = RGBColor(0x58, 0x6e, 0x75)
+	solarizedBase0   = RGBColor(0x83, 0x94, 0x96)
+	solarizedYellow  = RGBColor(0xb5, 0x89, 0x00)
+	solarizedOrange  = RGBColor(0xcb, 0x4b, 0x16)
+	solarizedRed     = RGBColor(0xdc, 0x32, 0x2f)
+	solarizedMagenta = RGBColor(0xd3, 0x36, 0x82)
+	solarizedViolet  = RGBColor(0x6c, 0x71, 0xc4)
+	solarizedBlue    = RGBColor(0x26, 0x8b, 0xd2)
+	solarizedCyan    = RGBColor(0x2a, 0xa1, 0x98)
+	solarizedGreen   = RGBColor(0x85, 0x99, 0x00)
+)
+
+// themeNames are the names of the built-in themes, in the order
+// ThemeNames returns them.
+var themeNames = []string{"default", "light-background", "dark", "solarized", "monochrome-bold", "high-contrast"}
+
+// themes are the built-in themes, other than the default.
+var themes = map[string]Theme{
+	"light-background": {
+		ElementHeader:         {Bold: true, Foreground: ColorBlue},
+		ElementHeader1:        {Underline: UnderlineSingle},
+		ElementLink:           {Foreground: ColorBlue, Underline: UnderlineSingle},
+		ElementImage:          {Foreground: ColorMagenta},
+		ElementCodeSpan:       {Foreground: ColorRed},
+		ElementBlockCode:      {Foreground: ColorBlack},
+		ElementStrikethrough:  {Foreground: ColorBrightBlack, Strikethrough: true},
+		ElementEmphasis:       {Italic: true},
+		ElementDoubleEmphasis: {Bold: true},
+		ElementTripleEmphasis: {Bold: true, Italic: true, Foreground: ColorRed},
+		ElementBlockQuote:     {Foreground: ColorBrightBlack},
+		ElementTableHeader:    {Bold: true},
+		ElementTableBorder:    {Foreground: ColorBrightBlack},
+		ElementMetadataName:   {Foreground: ColorBlue},
+	},
+	"dark": {
+		ElementHeader:         {Bold: true, Foreground: ColorBrightCyan},
+		ElementHeader1:        {Underline: UnderlineSingle},
+		ElementLink:           {Foreground: ColorBrightBlue, Underline: UnderlineSingle},
+		ElementImage:          {Foreground: ColorBrightMagenta},
+		ElementCodeSpan:       {Foreground: ColorBrightGreen},
+		ElementBlockCode:      {Foreground: ColorGreen},
+		ElementStrikethrough:  {Foreground: ColorBrightBlack, Strikethrough: true},
+		ElementEmphasis:       {Italic: true, Foreground: ColorBrightYellow},
+		ElementDoubleEmphasis: {Bold: true},
+		ElementTripleEmphasis: {Bold: true, Italic: true, Foreground: ColorBrightRed},
+		ElementBlockQuote:     {Italic: true},
+		ElementTableHeader:    {Bold: true},
+		ElementTableBorder:    {Foreground: ColorBrightBlack},
+		ElementMetadataName:   {Foreground: ColorBrightCyan},
+	},
+	"solarized": {
+		ElementHeader:         {Bold: true, Foreground: solarizedBlue},
+		ElementHeader1:        {Underline: UnderlineSingle},
+		ElementLink:           {Foreground: solarizedViolet, Underline: UnderlineSingle},
+		ElementImage:          {Foreground: solarizedMagenta},
+		ElementCodeSpan:       {Foreground: solarizedCyan},
+		ElementBlockCode:      {Foreground: solarizedBase0},
+		ElementStrikethrough:  {Foreground: solarizedBase01, Strikethrough: true},
+		ElementEmphasis:       {Italic: true, Foreground: solarizedYellow},
+		ElementDoubleEmphasis: {Bold: true, Foreground: solarizedOrange},
+		ElementTripleEmphasis: {Bold: true, Italic: true, Foreground: solarizedRed},
+		ElementBlockQuote:     {Italic: true, Foreground: solarizedBase01},
+		ElementTableHeader:    {Bold: true, Foreground: solarizedBlue},
+		ElementTableBorder:    {Foreground: solarizedBase01},
+		ElementMetadataName:   {Foreground: solarizedYellow},
+		ElementMetadataValue:  {Foreground: solarizedBase0},
+	},
+	"monochrome-bold": {
+		ElementHeader:         {Bold: true},
+		ElementHeader1:        {Underline: UnderlineSingle},
+		ElementLink:           {Underline: UnderlineSingle},
+		ElementImage:          {Italic: true},
+		ElementCodeSpan:       {Bold: true},
+		ElementBlockCode:      {},
+		ElementStrikethrough:  {Strikethrough: true},
+		ElementEmphasis:       {Italic: true},
+		ElementDoubleEmphasis: {Bold: true},
+		ElementTripleEmphasis: {Bold: true, Italic: true},
+		ElementBlockQuote:     {Dim: true},
+		ElementTableHeader:    {Bold: true},
+		ElementTableBorder:    {Dim: true},
+	},
+	"high-contrast": {
+		ElementHeader:         {Bold: true, Foreground: ColorBrightWhite, Underline: UnderlineSingle},
+		ElementLink:           {Bold: true, Foreground: ColorBrightCyan, Underline: UnderlineSingle},
+		ElementImage:          {Bold: true, Foreground: ColorBrightMagenta},
+		ElementCodeSpan:       {Bold: true, Foreground: ColorBrightYellow},
+		ElementBlockCode:      {Foreground: ColorBrightWhite},
+		ElementStrikethrough:  {Foreground: ColorBrightRed, Strikethrough: true},
+		ElementEmphasis:       {Italic: true, Foreground: ColorBrightYellow},
+		ElementDoubleEmphasis: {Bold: true, Foreground: ColorBrightWhite},
+		ElementTripleEmphasis: {Bold: true, Italic: true, Foreground: ColorBrightRed},
+		ElementBlockQuote:     {Italic: true, Foreground: ColorBrightWhite},
+		ElementTableHeader:    {Bold: true, Reverse: true},
+		ElementTableBorder:    {Foreground: ColorBrightWhite},
+		ElementMetadataName:   {Foreground: ColorBrightCyan},
+		ElementMetadataValue:  {Foreground: ColorBrightWhite},
+	},
+}
+
+// ThemeNames returns the names of the built-in themes.
+func ThemeNames() []string {
+	return append([]string(nil), themeNames...)
+}
+
+// NamedTheme returns a copy of the built-in theme of the name, or nil if
+// there is no such theme. The "default" theme is the styles elements have
+// by default.
+func NamedTheme(name string) Theme {
+	from := themes[name]
+	if name == "default" {
+		from = defaultStyles
+	} else if from == nil {
+		return nil
+	}
+	theme := Theme{}
+	for e, s := range from {
+		theme[e] = s
+	}
+	return theme
+}
+
+// LoadTheme parses a theme file, TOML or, if it starts with "{", JSON. Each
+// table, or object, is the style of the element it is named for, as
+// Element.String names them, and "base" may name a built-in theme the file
+// changes:
+//
+//	base = "dark"
+//
+//	[header]
+//	foreground = "bright-cyan"
+//	bold = true
+//
+//	[block-quote]
+//	foreground = "#586e75"
+//	italic = true
+//
+// Styles have the keys foreground, background, bold, dim, italic,
+// underline, strikethrough and reverse. Colors are "default", the names of
+// the 8 ANSI colors such as "red", with "bright-" before them for their
+// bright versions, 256 color palette indexes, or "#rrggbb". Underline is
+// true or false, or "single", "double", "curly", "dotted" or "dashed".
+func LoadTheme(data []byte) (Theme, error) {
+	var m *FrontMatterMap
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		m, err = jsonFrontMatter{}.Parse(data)
+	} else {
+		m, err = parseTOML(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("theme: %s", err)
+	}
+	theme := Theme{}
+	if v, ok := m.Get("base"); ok {
+		name, _ := v.(string)
+		if theme = NamedTheme(name); theme == nil {
+			return nil, fmt.Errorf("theme: unknown base theme %q", name)
+		}
+	}
+	for _, key := range m.Keys() {
+		if key == "base" {
+			continue
+		}
+		e, ok := namedElement(key)
+		if !ok {
+			return nil, fmt.Errorf("theme: unknown element %q", key)
+		}
+		fields, ok := m.Map(key)
+		if !ok {
+			return nil, fmt.Errorf("theme: %s: not a table", key)
+		}
+		s, err := parseThemeStyle(fields)
+		if err != nil {
+			return nil, fmt.Errorf("theme: %s: %s", key, err)
+		}
+		theme[e] = s
+	}
+	return theme, nil
+}
+
+// namedElement returns the element of the name Element.String gives it.
+func namedElement(name string) (Element, bool) {
+	for e, n := range elementNames {
+		if n == name {
+			return Element(e), true
+		}
+	}
+	return 0, false
+}
+
+// parseThemeStyle returns the style the fields of a theme file describe.
+func parseThemeStyle(fields *FrontMatterMap) (Style, error) {
+	var s Style
+	for _, key := range fields.Keys() {
+		v, _ := fields.Get(key)
+		var err error
+		switch key {
+		case "foreground":
+			s.Foreground, err = parseThemeColor(v)
+		case "background":
+			s.Background, err = parseThemeColor(v)
+		case "underline":
+			s.Underline, err = parseThemeUnderline(v)
+		case "bold", "dim", "italic", "strikethrough", "reverse":
+			b, ok := fields.Bool(key)
+			if !ok {
+				return s, fmt.Errorf("%s: not true or false", key)
+			}
+			switch key {
+			case "bold":
+				s.Bold = b
+			case "dim":
+				s.Dim = b
+			case "italic":
+				s.Italic = b
+			case "strikethrough":
+				s.Strikethrough = b
+			case "reverse":
+				s.Reverse = b
+			}
+		default:
+			return s, fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return s, fmt.Errorf("%s: %s", key, err)
+		}
+	}
+	return s, nil
+}
+
+// parseThemeColor returns the color of a theme file value.
+func parseThemeColor(v interface{}) (Color, error) {
+	switch t := v.(type) {
+	case int64:
+		if t < 0 || t > 255 {
+			return 0, fmt.Errorf("palette index %d is not 0 through 255", t)
+		}
+		return PaletteColor(uint8(t)), nil
+	case string:
+		if t == "default" {
+			return ColorDefault, nil
+		}
+		if strings.HasPrefix(t, "#") {
+			rgb, err := strconv.ParseUint(t[1:], 16, 32)
+			if err != nil || len(t) != 7 {
+				return 0, fmt.Errorf("%q is not #rrggbb", t)
+			}
+			return RGBColor(uint8(rgb>>16), uint8(rgb>>8), uint8(rgb)), nil
+		}
+		name := strings.TrimPrefix(t, "bright-")
+		for i, n := range colorNames {
+			if n == name {
+				if name != t {
+					i += 8
+				}
+				return ANSIColor(uint8(i)), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown color %v", v)
+}
+
+// parseThemeUnderline returns the underline of a theme file value.
+func parseThemeUnderline(v interface{}) (Underline, error) {
+	switch t := v.(type) {
+	case bool:
+		if t {
+			return UnderlineSingle, nil
+		}
+		return UnderlineNone, nil
+	case string:
+		for u, name := range []string{"none", "single", "double", "curly", "dotted", "dashed"} {
+			if t == name {
+				return Underline(u), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown underline %v", v)
+}
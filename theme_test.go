@@ -0,0 +1,207 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/russross/blackfriday/v2"
+)
+
+func TestNamedTheme(t *testing.T) {
+	in := "# Head *em*\n\n> quote [link](http://x)\n\n| a |\n|---|\n| `1` |\n\n```go\nreturn 1 // done\n```\n"
+	exp := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, Color: true}))
+	out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, Color: true, Styles: NamedTheme("default")}))
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	for _, name := range ThemeNames() {
+		theme := NamedTheme(name)
+		if theme == nil {
+			t.Errorf("%#v has no theme", name)
+			continue
+		}
+		if name != "default" && len(theme) < len(defaultStyles) {
+			t.Errorf("%#v styles %d elements, not all %d with defaults", name, len(theme), len(defaultStyles))
+		}
+		out := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40, Styles: theme}))
+		exp := string(MarkdownToTextNoMetadata([]byte(in), &Options{Width: 40}))
+		if out != exp {
+			t.Errorf("%#v: %#v != %#v", name, out, exp)
+		}
+	}
+	if theme := NamedTheme("nope"); theme != nil {
+		t.Errorf("%#v != nil", theme)
+	}
+	NamedTheme("dark")[ElementHeader] = Style{}
+	if NamedTheme("dark")[ElementHeader].IsZero() {
+		t.Errorf("built-in theme changed")
+	}
+}
+
+// tokenRenderer styles the words of code blocks as tokens: numbers, quoted
+// strings, words from "//" on as comments, and others as keywords.
+type tokenRenderer struct {
+	BaseRenderer
+}
+
+func (r *tokenRenderer) RenderNode(w *Writer, node *blackfriday.Node, entering bool) blackfriday.WalkStatus {
+	if node.Type != blackfriday.CodeBlock {
+		return r.BaseRenderer.RenderNode(w, node, entering)
+	}
+	w.EnsureBlankLine()
+	w.StartStyle(ElementBlockCode)
+	words := strings.Fields(string(node.Literal))
+	for i, word := range words {
+		if i > 0 {
+			w.WriteNoWrap([]byte(" "))
+		}
+		e := ElementCodeKeyword
+		switch {
+		case word == "//":
+			e = ElementCodeComment
+			word = strings.Join(words[i:], " ")
+		case strings.Trim(word, "0123456789") == "":
+			e = ElementCodeNumber
+		case strings.HasPrefix(word, "\""):
+			e = ElementCodeString
+		}
+		w.StartStyle(e)
+		w.WriteNoWrap([]byte(word))
+		w.EndStyle(e)
+		if e == ElementCodeComment {
+			break
+		}
+	}
+	w.EndStyle(ElementBlockCode)
+	w.LineBreak()
+	w.EnsureBlankLine()
+	return blackfriday.GoToNext
+}
+
+func TestThemeElements(t *testing.T) {
+	theme := Theme{
+		ElementHeader2:       {Foreground: ColorCyan},
+		ElementBlockQuote:    {Italic: true},
+		ElementTableHeader:   {Bold: true},
+		ElementTableBorder:   {Foreground: ColorBrightBlack},
+		ElementCodeKeyword:   {Foreground: ColorMagenta},
+		ElementCodeString:    {Foreground: ColorYellow},
+		ElementCodeComment:   {Dim: true},
+		ElementCodeNumber:    {Foreground: ColorCyan},
+		ElementMetadataName:  {Foreground: ColorBlue},
+		ElementMetadataValue: {Italic: true},
+	}
+	for _, c := range []struct {
+		in  string
+		exp string
+	}{
+		{"# One\n\n## Two\n", "--[ \x1b[1mOne\x1b[0m ]--\n\n    --[ \x1b[1;36mTwo\x1b[0m ]--\n\n"},
+		{"> quoted *text*\n", "> \x1b[3mquoted \x1b[33mtext\x1b[0m\n"},
+		{"| a | b |\n|---|---|\n| 1 | 2 |\n", "\x1b[90m╔═══╦═══╗\x1b[0m\n\x1b[90m║ \x1b[0m\x1b[1ma\x1b[0m\x1b[90m ║ \x1b[0m\x1b[1mb\x1b[0m\x1b[90m ║\x1b[0m\n\x1b[90m╠═══╬═══╣\x1b[0m\n\x1b[90m║ \x1b[0m1\x1b[90m ║ \x1b[0m2\x1b[90m ║\x1b[0m\n\x1b[90m╚═══╩═══╝\x1b[0m\n"},
+		{"```go\nreturn 42 \"x\" // c\n```\n", "\x1b[35mreturn\x1b[32m \x1b[36m42\x1b[32m \x1b[33m\"x\"\x1b[32m \x1b[2m// c\x1b[0m\n\n"},
+	} {
+		out := string(MarkdownToTextNoMetadata([]byte(c.in), &Options{Width: 40, Color: true, Styles: theme, Renderer: &tokenRenderer{}}))
+		if out != c.exp {
+			t.Errorf("%#v != %#v", out, c.exp)
+		}
+	}
+	metadata := Metadata{{Name: "Title", Value: "T"}, {Name: "Author", Value: "Me"}}
+	out := string(RenderMetadata(metadata, &Options{Width: 40, Color: true, Styles: theme}))
+	exp := "\x1b[1;34mTitle:\x1b[0m  \x1b[3mT\x1b[0m\n\x1b[1;34mAuthor:\x1b[0m \x1b[3mMe\x1b[0m\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestLoadTheme(t *testing.T) {
+	exp := Theme{
+		ElementHeader:      {Foreground: ColorBrightCyan, Bold: true},
+		ElementHeader1:     {Underline: UnderlineDouble},
+		ElementCodeComment: {Foreground: RGBColor(0x58, 0x6e, 0x75), Italic: true},
+		ElementTableBorder: {Foreground: PaletteColor(240), Background: ColorBlack},
+		ElementLink:        {Underline: UnderlineSingle, Reverse: true},
+	}
+	for _, in := range []string{`
+[header]
+foreground = "bright-cyan"
+bold = true
+
+[header1]
+underline = "double"
+
+[code-comment]
+foreground = "#586e75"
+italic = true
+
+[table-border]
+foreground = 240
+background = "black"
+
+[link]
+underline = true
+reverse = true
+`, `{
+	"header": {"foreground": "bright-cyan", "bold": true},
+	"header1": {"underline": "double"},
+	"code-comment": {"foreground": "#586e75", "italic": true},
+	"table-border": {"foreground": 240, "background": "black"},
+	"link": {"underline": true, "reverse": true}
+}`} {
+		theme, err := LoadTheme([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(theme) != len(exp) {
+			t.Errorf("%#v != %#v", theme, exp)
+		}
+		for e, s := range exp {
+			if theme[e].attrs() != s.attrs() {
+				t.Errorf("%s: %#v != %#v", e, theme[e], s)
+			}
+		}
+	}
+	theme, err := LoadTheme([]byte("base = \"solarized\"\n[header]\nbold = true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(theme) != len(NamedTheme("solarized")) || theme[ElementHeader].attrs() != (Style{Bold: true}).attrs() || theme[ElementLink].attrs() != NamedTheme("solarized")[ElementLink].attrs() {
+		t.Errorf("%#v", theme)
+	}
+	for _, c := range []struct {
+		in  string
+		exp string
+	}{
+		{"base = \"nope\"\n", `theme: unknown base theme "nope"`},
+		{"[heading]\nbold = true\n", `theme: unknown element "heading"`},
+		{"header = 1\n", "theme: header: not a table"},
+		{"[header]\nblink = true\n", `theme: header: unknown key "blink"`},
+		{"[header]\nbold = 1\n", "theme: header: bold: not true or false"},
+		{"[header]\nforeground = \"pink\"\n", "theme: header: foreground: unknown color pink"},
+		{"[header]\nforeground = \"#12345\"\n", `theme: header: foreground: "#12345" is not #rrggbb`},
+		{"[header]\nbackground = 256\n", "theme: header: background: palette index 256 is not 0 through 255"},
+		{"[header]\nunderline = \"wavy\"\n", "theme: header: underline: unknown underline wavy"},
+		{"{\"header\": ", "theme: EOF"},
+	} {
+		_, err := LoadTheme([]byte(c.in))
+		if err == nil || err.Error() != c.exp {
+			t.Errorf("%#v != %#v", err, c.exp)
+		}
+	}
+}
+
+func TestElementString(t *testing.T) {
+	for e := ElementHeader; e <= ElementMetadataValue; e++ {
+		if name := e.String(); name == "" {
+			t.Errorf("%d has no name", e)
+		} else if n, ok := namedElement(name); !ok || n != e {
+			t.Errorf("%#v != %#v", n, e)
+		}
+	}
+	if s := Element(-1).String(); s != "Element(-1)" {
+		t.Errorf("%#v != %#v", s, "Element(-1)")
+	}
+}
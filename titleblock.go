@@ -0,0 +1,64 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strings"
+)
+
+// titleBlock parses a Pandoc title block at the start of the markdown,
+// returning its Title, Author and Date items and the position just after
+// its lines, or nil and 0 if there is none.
+//
+// A title block is up to three lines, each starting with "% ", giving the
+// title, the authors separated by ";" and the date; an empty field is just
+// "%". Lines starting with a space continue the field above: more of the
+// title or more authors.
+func titleBlock(markdown []byte) (Metadata, int) {
+	if first, _ := nextLine(markdown, 0); !isTitleBlockLine(first) {
+		return nil, 0
+	}
+	var fields [3][]string
+	field := -1
+	pos := 0
+	for pos < len(markdown) {
+		line, next := nextLine(markdown, pos)
+		if isTitleBlockLine(line) {
+			field++
+			line = line[1:]
+		} else if len(bytes.TrimSpace(line)) == 0 || (line[0] != ' ' && line[0] != '\t') {
+			break
+		}
+		pos = next
+		if field >= len(fields) {
+			continue
+		}
+		if value := strings.TrimSpace(string(line)); value != "" {
+			fields[field] = append(fields[field], value)
+		}
+	}
+	m := Metadata{}
+	if len(fields[0]) > 0 {
+		m = append(m, MetadataItem{Name: "Title", Value: strings.Join(fields[0], " ")})
+	}
+	for _, line := range fields[1] {
+		for _, author := range strings.Split(line, ";") {
+			if author = strings.TrimSpace(author); author != "" {
+				m = append(m, MetadataItem{Name: "Author", Value: author})
+			}
+		}
+	}
+	if len(fields[2]) > 0 {
+		m = append(m, MetadataItem{Name: "Date", Value: strings.Join(fields[2], " ")})
+	}
+	return m, pos
+}
+
+// isTitleBlockLine returns true if the line, without its newline or trailing
+// space, starts a title block field: "%" alone or followed by a space.
+func isTitleBlockLine(line []byte) bool {
+	return len(line) > 0 && line[0] == '%' && (len(line) == 1 || line[1] == ' ')
+}
@@ -0,0 +1,79 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testTitleBlock = `% The Document Title
+  continued
+% One; Two
+  Three
+% 2024-01-02
+
+Body text here.
+`
+
+func TestTitleBlockMetadata(t *testing.T) {
+	m, pos := ParseMetadata([]byte(testTitleBlock))
+	exp := Metadata{
+		{Name: "Title", Value: "The Document Title continued"},
+		{Name: "Author", Value: "One"},
+		{Name: "Author", Value: "Two"},
+		{Name: "Author", Value: "Three"},
+		{Name: "Date", Value: "2024-01-02"},
+	}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("%#v != %#v", m, exp)
+	}
+	if testTitleBlock[pos:] != "\nBody text here.\n" {
+		t.Errorf("%#v", testTitleBlock[pos:])
+	}
+	m, _ = ParseMetadata([]byte("% Title\n%\n% May 2024\nBody\n"))
+	exp = Metadata{{Name: "Title", Value: "Title"}, {Name: "Date", Value: "May 2024"}}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("%#v != %#v", m, exp)
+	}
+	for _, in := range []string{"Not % a title block\n", "%s formats a string\n"} {
+		if m, pos := titleBlock([]byte(in)); m != nil || pos != 0 {
+			t.Errorf("%#v: %#v %d", in, m, pos)
+		}
+	}
+	m, _ = ParseMetadata([]byte("% Title\n%d is not a date\n\nBody\n"))
+	exp = Metadata{{Name: "Title", Value: "Title"}}
+	if !reflect.DeepEqual(m, exp) {
+		t.Errorf("%#v != %#v", m, exp)
+	}
+	out := string(MarkdownToTextNoMetadata([]byte("%s formats a string\n"), &Options{Width: 40}))
+	if exp := "%s formats a string\n"; out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
+
+func TestTitleBlockBanner(t *testing.T) {
+	out := string(MarkdownToTextNoMetadata([]byte(testTitleBlock), &Options{Width: 40}))
+	exp := `      The Document Title continued
+      ============================
+      One, Two, Three - 2024-01-02
+
+Body text here.
+`
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	out = string(MarkdownToTextNoMetadata([]byte("% Title\n\nText\n"), &Options{Width: 20, Color: true}))
+	exp = "       \x1b[1mTitle\x1b[0m\n\nText\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+	// Only at the very start.
+	out = string(MarkdownToTextNoMetadata([]byte("Text\n\n%d is a verb.\n"), &Options{Width: 40}))
+	exp = "Text\n\n%d is a verb.\n"
+	if out != exp {
+		t.Errorf("%#v != %#v", out, exp)
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseTOML parses TOML as typically found in front matter: key/value pairs
+// with dotted and quoted keys, [tables], [[arrays of tables]], all string
+// forms, integers, floats, booleans, arrays and inline tables. Dates and
+// times are kept as strings.
+//
+// Tables are returned as *FrontMatterMap, arrays as []interface{}, and
+// scalars as string, int64, float64 or bool.
+func parseTOML(text string) (*FrontMatterMap, error) {
+	p := &tomlParser{s: strings.Replace(text, "\r\n", "\n", -1)}
+	root := NewFrontMatterMap()
+	current := root
+	for {
+		p.skipSpace(true)
+		if p.i >= len(p.s) {
+			return root, nil
+		}
+		if p.s[p.i] == '[' {
+			array := strings.HasPrefix(p.s[p.i:], "[[")
+			if array {
+				p.i += 2
+			} else {
+				p.i++
+			}
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			closing := "]"
+			if array {
+				closing = "]]"
+			}
+			p.skipSpace(false)
+			if !strings.HasPrefix(p.s[p.i:], closing) {
+				return nil, p.errorf("expected %s", closing)
+			}
+			p.i += len(closing)
+			if current, err = p.table(root, path, array); err != nil {
+				return nil, err
+			}
+		} else {
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(false)
+			if p.i >= len(p.s) || p.s[p.i] != '=' {
+				return nil, p.errorf("expected =")
+			}
+			p.i++
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			parent, err := p.table(current, path[:len(path)-1], false)
+			if err != nil {
+				return nil, err
+			}
+			parent.Set(path[len(path)-1], v)
+		}
+		p.skipSpace(false)
+		if p.i < len(p.s) && p.s[p.i] != '\n' {
+			return nil, p.errorf("expected end of line")
+		}
+	}
+}
+
+type tomlParser struct {
+	s string
+	i int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("toml: line %d: %s", strings.Count(p.s[:p.i], "\n")+1, fmt.Sprintf(format, args...))
+}
+
+// skipSpace moves past spaces, tabs and comments and, if newlines is true,
+// newlines as well.
+func (p *tomlParser) skipSpace(newlines bool) {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t' || (newlines && c == '\n'):
+			p.i++
+		case c == '#':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// table returns the table at path below m, creating tables as needed. For
+// an array of tables the last element is used, unless appendNew is true, in
+// which case a new element is appended to the array at path.
+func (p *tomlParser) table(m *FrontMatterMap, path []string, appendNew bool) (*FrontMatterMap, error) {
+	for i, key := range path {
+		last := i == len(path)-1
+		v, ok := m.values[key]
+		if !ok {
+			if last && appendNew {
+				nested := NewFrontMatterMap()
+				m.Set(key, []interface{}{nested})
+				return nested, nil
+			}
+			nested := NewFrontMatterMap()
+			m.Set(key, nested)
+			m = nested
+			continue
+		}
+		switch t := v.(type) {
+		case *FrontMatterMap:
+			if last && appendNew {
+				return nil, p.errorf("%s is not an array of tables", key)
+			}
+			m = t
+		case []interface{}:
+			if last && appendNew {
+				nested := NewFrontMatterMap()
+				m.values[key] = append(t, nested)
+				return nested, nil
+			}
+			if len(t) == 0 {
+				return nil, p.errorf("%s is not a table", key)
+			}
+			nested, ok := t[len(t)-1].(*FrontMatterMap)
+			if !ok {
+				return nil, p.errorf("%s is not a table", key)
+			}
+			m = nested
+		default:
+			return nil, p.errorf("%s is not a table", key)
+		}
+	}
+	return m, nil
+}
+
+// parseKey parses a possibly dotted key, returning its parts.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var path []string
+	for {
+		p.skipSpace(false)
+		if p.i >= len(p.s) {
+			return nil, p.errorf("expected a key")
+		}
+		switch p.s[p.i] {
+		case '"', '\'':
+			v, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, v)
+		default:
+			start := p.i
+			for p.i < len(p.s) && isTOMLBareKeyByte(p.s[p.i]) {
+				p.i++
+			}
+			if p.i == start {
+				return nil, p.errorf("expected a key")
+			}
+			path = append(path, p.s[start:p.i])
+		}
+		p.skipSpace(false)
+		if p.i >= len(p.s) || p.s[p.i] != '.' {
+			return path, nil
+		}
+		p.i++
+	}
+}
+
+func isTOMLBareKeyByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-'
+}
+
+func (p *tomlParser) parseValue() (interface{}, error) {
+	p.skipSpace(false)
+	if p.i >= len(p.s) {
+		return nil, p.errorf("expected a value")
+	}
+	switch p.s[p.i] {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		p.i++
+		list := []interface{}{}
+		for {
+			p.skipSpace(true)
+			if p.i >= len(p.s) {
+				return nil, p.errorf("unclosed array")
+			}
+			if p.s[p.i] == ']' {
+				p.i++
+				return list, nil
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			p.skipSpace(true)
+			if p.i < len(p.s) && p.s[p.i] == ',' {
+				p.i++
+			} else if p.i >= len(p.s) || p.s[p.i] != ']' {
+				return nil, p.errorf("expected , or ]")
+			}
+		}
+	case '{':
+		p.i++
+		m := NewFrontMatterMap()
+		p.skipSpace(false)
+		if p.i < len(p.s) && p.s[p.i] == '}' {
+			p.i++
+			return m, nil
+		}
+		for {
+			path, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			if p.i >= len(p.s) || p.s[p.i] != '=' {
+				return nil, p.errorf("expected =")
+			}
+			p.i++
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			parent, err := p.table(m, path[:len(path)-1], false)
+			if err != nil {
+				return nil, err
+			}
+			parent.Set(path[len(path)-1], v)
+			p.skipSpace(false)
+			if p.i < len(p.s) && p.s[p.i] == ',' {
+				p.i++
+				continue
+			}
+			if p.i < len(p.s) && p.s[p.i] == '}' {
+				p.i++
+				return m, nil
+			}
+			return nil, p.errorf("expected , or }")
+		}
+	}
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t\n,]}#", p.s[p.i]) == -1 {
+		p.i++
+	}
+	token := p.s[start:p.i]
+	// A space may separate the date and time of a datetime.
+	if tomlDatePattern.MatchString(token) && p.i+1 < len(p.s) && p.s[p.i] == ' ' && p.s[p.i+1] >= '0' && p.s[p.i+1] <= '9' {
+		p.i++
+		for p.i < len(p.s) && strings.IndexByte(" \t\n,]}#", p.s[p.i]) == -1 {
+			p.i++
+		}
+		token = p.s[start:p.i]
+	}
+	switch {
+	case token == "true":
+		return true, nil
+	case token == "false":
+		return false, nil
+	case tomlDatePattern.MatchString(token) || tomlTimePattern.MatchString(token):
+		return token, nil
+	}
+	clean := strings.Replace(token, "_", "", -1)
+	if len(clean) > 2 && clean[0] == '0' && strings.IndexByte("xob", clean[1]) != -1 {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[clean[1]]
+		if v, err := strconv.ParseInt(clean[2:], base, 64); err == nil {
+			return v, nil
+		}
+	}
+	if v, err := strconv.ParseInt(clean, 10, 64); err == nil {
+		return v, nil
+	}
+	if v, err := strconv.ParseFloat(clean, 64); err == nil {
+		return v, nil
+	}
+	return nil, p.errorf("invalid value %q", token)
+}
+
+var (
+	tomlDatePattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[-+]\d{2}:\d{2})?)?$`)
+	tomlTimePattern = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?$`)
+)
+
+// parseString parses any of the four TOML string forms.
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.s[p.i]
+	multi := strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3))
+	if multi {
+		p.i += 3
+		// A newline right after the opening delimiter is trimmed.
+		if p.i < len(p.s) && p.s[p.i] == '\n' {
+			p.i++
+		}
+	} else {
+		p.i++
+	}
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		switch {
+		case multi && strings.HasPrefix(p.s[p.i:], strings.Repeat(string(quote), 3)):
+			p.i += 3
+			// Up to two more quotes may be part of the string.
+			for n := 0; n < 2 && p.i < len(p.s) && p.s[p.i] == quote; n++ {
+				b.WriteByte(quote)
+				p.i++
+			}
+			return b.String(), nil
+		case !multi && c == quote:
+			p.i++
+			return b.String(), nil
+		case !multi && c == '\n':
+			return "", p.errorf("unclosed string")
+		case c == '\\' && quote == '"':
+			p.i++
+			if p.i >= len(p.s) {
+				return "", p.errorf("unclosed string")
+			}
+			e := p.s[p.i]
+			p.i++
+			switch e {
+			case 'b':
+				b.WriteByte('\b')
+			case 't':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case '"', '\\':
+				b.WriteByte(e)
+			case 'u', 'U':
+				n := 4
+				if e == 'U' {
+					n = 8
+				}
+				if p.i+n > len(p.s) {
+					return "", p.errorf("bad escape")
+				}
+				r, err := strconv.ParseUint(p.s[p.i:p.i+n], 16, 32)
+				if err != nil || !utf8.ValidRune(rune(r)) {
+					return "", p.errorf("bad escape")
+				}
+				b.WriteRune(rune(r))
+				p.i += n
+			case ' ', '\t', '\n':
+				// A line ending backslash trims all following whitespace.
+				if !multi {
+					return "", p.errorf("bad escape")
+				}
+				for p.i < len(p.s) && strings.IndexByte(" \t\n", p.s[p.i]) != -1 {
+					p.i++
+				}
+			default:
+				return "", p.errorf("bad escape")
+			}
+		default:
+			b.WriteByte(c)
+			p.i++
+		}
+	}
+	return "", p.errorf("unclosed string")
+}
@@ -0,0 +1,94 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	m, err := parseTOML(`# A comment
+title = "Front \"Matter\"" # trailing comment
+'literal key' = 'C:\path'
+draft = false
+weight = 1_000
+hex = 0xff
+ratio = 6.5e-1
+date = 2024-01-02T03:04:05Z
+local = 2024-01-02 03:04:05
+tags = [
+  "go",
+  'text', # comment
+]
+author.name = "Someone"
+point = { x = 1, y = 2 }
+notes = """
+Line one
+Line two \
+  continued"""
+
+[params]
+color = "blue"
+
+[params.nested]
+deep = true
+
+[[people]]
+name = "A"
+
+[[people]]
+name = "B"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		path []string
+		exp  interface{}
+	}{
+		{[]string{"title"}, `Front "Matter"`},
+		{[]string{"literal key"}, `C:\path`},
+		{[]string{"draft"}, false},
+		{[]string{"weight"}, int64(1000)},
+		{[]string{"hex"}, int64(255)},
+		{[]string{"ratio"}, 0.65},
+		{[]string{"date"}, "2024-01-02T03:04:05Z"},
+		{[]string{"local"}, "2024-01-02 03:04:05"},
+		{[]string{"tags"}, []interface{}{"go", "text"}},
+		{[]string{"author", "name"}, "Someone"},
+		{[]string{"point", "y"}, int64(2)},
+		{[]string{"notes"}, "Line one\nLine two continued"},
+		{[]string{"params", "color"}, "blue"},
+		{[]string{"params", "nested", "deep"}, true},
+		{[]string{"people", "0", "name"}, "A"},
+		{[]string{"people", "1", "name"}, "B"},
+	} {
+		if v, ok := m.Get(c.path...); !ok || !reflect.DeepEqual(v, c.exp) {
+			t.Errorf("%v: %#v != %#v", c.path, v, c.exp)
+		}
+	}
+	exp := []string{"title", "literal key", "draft", "weight", "hex", "ratio", "date", "local", "tags", "author", "point", "notes", "params", "people"}
+	if keys := m.Keys(); !reflect.DeepEqual(keys, exp) {
+		t.Errorf("%#v != %#v", keys, exp)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, in := range []string{
+		"a = [1, 2",
+		"a = \"unclosed",
+		"a = 1 b = 2",
+		"a = what",
+		"just text",
+		"a = 1\n[a]",
+		"[t]\n[[t]]",
+		"a = \"bad \\q escape\"",
+	} {
+		if m, err := parseTOML(in); err == nil {
+			t.Errorf("%#v: expected error, got %#v", in, m)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ExpandVariables replaces placeholders such as "{{Version}}" in the
+// markdown with values from opts.Variables or, failing that, the metadata;
+// names are compared with NormalizeMetadataKey and spaces just inside the
+// delimiters are ignored. The delimiters are opts.VariableDelimiters, "{{"
+// and "}}" by default, and a placeholder preceded by opts.VariableEscape,
+// "\" by default, is left as written without the escape.
+//
+// Placeholders with no value are left as written and their names returned,
+// each just once, in the order found. If opts is nil the defaults will be
+// used.
+func ExpandVariables(markdown []byte, metadata Metadata, opts *Options) ([]byte, []string) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	open, close := opts.VariableDelimiters[0], opts.VariableDelimiters[1]
+	if open == "" || close == "" {
+		open, close = "{{", "}}"
+	}
+	escape := opts.VariableEscape
+	if escape == "" {
+		escape = "\\"
+	}
+	values := make(map[string]string, len(metadata)+len(opts.Variables))
+	for i := len(metadata) - 1; i >= 0; i-- {
+		values[NormalizeMetadataKey(metadata[i].Name)] = metadata[i].Value
+	}
+	for name, value := range opts.Variables {
+		values[NormalizeMetadataKey(name)] = value
+	}
+	var out bytes.Buffer
+	var unresolved []string
+	seen := make(map[string]bool)
+	for {
+		i := bytes.Index(markdown, []byte(open))
+		if i == -1 {
+			out.Write(markdown)
+			break
+		}
+		j := bytes.Index(markdown[i+len(open):], []byte(close))
+		if j == -1 {
+			out.Write(markdown)
+			break
+		}
+		j += i + len(open)
+		if bytes.HasSuffix(markdown[:i], []byte(escape)) {
+			out.Write(markdown[:i-len(escape)])
+			out.Write(markdown[i : j+len(close)])
+			markdown = markdown[j+len(close):]
+			continue
+		}
+		name := strings.TrimSpace(string(markdown[i+len(open) : j]))
+		out.Write(markdown[:i])
+		if value, ok := values[NormalizeMetadataKey(name)]; ok && name != "" {
+			out.WriteString(value)
+		} else {
+			out.Write(markdown[i : j+len(close)])
+			if !seen[name] {
+				seen[name] = true
+				unresolved = append(unresolved, name)
+			}
+		}
+		markdown = markdown[j+len(close):]
+	}
+	return out.Bytes(), unresolved
+}
@@ -0,0 +1,62 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandVariables(t *testing.T) {
+	metadata := Metadata{{Name: "Product Name", Value: "Widget"}, {Name: "Version", Value: "1.0"}, {Name: "Version", Value: "2.0"}}
+	in := "{{ productname }} {{Version}} {{Build}} \\{{Version}} {{Missing}} {{Build}} {{unclosed"
+	out, unresolved := ExpandVariables([]byte(in), metadata, &Options{Variables: map[string]string{"build": "42"}})
+	exp := "Widget 1.0 42 {{Version}} {{Missing}} 42 {{unclosed"
+	if string(out) != exp {
+		t.Errorf("%#v != %#v", string(out), exp)
+	}
+	if !reflect.DeepEqual(unresolved, []string{"Missing"}) {
+		t.Errorf("%#v", unresolved)
+	}
+	// Variables take precedence over metadata.
+	out, _ = ExpandVariables([]byte("{{Version}}"), metadata, &Options{Variables: map[string]string{"Version": "3.0"}})
+	if string(out) != "3.0" {
+		t.Errorf("%#v", string(out))
+	}
+	opts := &Options{VariableDelimiters: [2]string{"${", "}"}, VariableEscape: "$"}
+	out, unresolved = ExpandVariables([]byte("${Version} $${Version} {{Version}} ${} ${}"), metadata, opts)
+	if exp := "1.0 ${Version} {{Version}} ${} ${}"; string(out) != exp {
+		t.Errorf("%#v != %#v", string(out), exp)
+	}
+	if !reflect.DeepEqual(unresolved, []string{""}) {
+		t.Errorf("%#v", unresolved)
+	}
+}
+
+func TestMarkdownToTextExpandVariables(t *testing.T) {
+	in := "Product: Widget\n\nUse *{{Product}}* version {{Version}}.\n\n///\n\nInstall {{Product}} {{Nope}}.\n"
+	var unresolved []string
+	opts := &Options{
+		Width:              80,
+		ExpandVariables:    true,
+		Variables:          map[string]string{"Version": "1.2"},
+		UnresolvedVariable: func(name string) { unresolved = append(unresolved, name) },
+	}
+	m, out := MarkdownToTextMetadata([]byte(in), opts)
+	if exp := "Use *Widget* version 1.2.\n\nInstall Widget {{Nope}}.\n"; string(out) != exp {
+		t.Errorf("%#v != %#v", string(out), exp)
+	}
+	if v, _ := m.Get("Summary"); v != "\nUse *Widget* version 1.2.\n" {
+		t.Errorf("%#v", v)
+	}
+	if !reflect.DeepEqual(unresolved, []string{"Nope"}) {
+		t.Errorf("%#v", unresolved)
+	}
+	// Without the option, placeholders are left alone.
+	out = MarkdownToTextNoMetadata([]byte("{{Product}}"), &Options{Width: 80})
+	if string(out) != "{{Product}}\n" {
+		t.Errorf("%#v", string(out))
+	}
+}
@@ -0,0 +1,587 @@
+// Copyright Gregory Holt. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package blackfridaytext
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// parseYAML parses the subset of YAML typically found in front matter:
+// block mappings and sequences, flow [lists] and {maps}, plain and quoted
+// scalars, and | and > block scalars. Anchors, aliases, tags and multiple
+// documents are not supported. The top level must be a mapping.
+//
+// Mappings are returned as *FrontMatterMap, sequences as []interface{}, and
+// scalars as string, int64, float64, bool or nil.
+func parseYAML(text string) (*FrontMatterMap, error) {
+	p := &yamlParser{lines: strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")}
+	if !p.skipBlank() {
+		return NewFrontMatterMap(), nil
+	}
+	indent, _ := p.current()
+	v, err := p.parseNode(indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank() {
+		return nil, p.errorf("unexpected content")
+	}
+	m, ok := v.(*FrontMatterMap)
+	if !ok {
+		return nil, fmt.Errorf("yaml: top level is not a mapping")
+	}
+	return m, nil
+}
+
+// startsYAMLMapping returns true if text is blank or its first line other
+// than blank and comment lines is a "key: value" line.
+func startsYAMLMapping(text string) bool {
+	p := &yamlParser{lines: strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")}
+	if !p.skipBlank() {
+		return true
+	}
+	_, line := p.current()
+	_, _, ok := splitYAMLKey(line)
+	return ok
+}
+
+type yamlParser struct {
+	lines []string
+	i     int
+	// override, if not nil, replaces the current line's indentation and
+	// text; used when a sequence item contains a mapping or sequence on the
+	// same line as its "- ".
+	override *yamlLine
+}
+
+type yamlLine struct {
+	indent int
+	text   string
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("yaml: line %d: %s", p.i+1, fmt.Sprintf(format, args...))
+}
+
+// current returns the current line's indentation and its text with any
+// comment and trailing space removed.
+func (p *yamlParser) current() (int, string) {
+	if p.override != nil {
+		return p.override.indent, p.override.text
+	}
+	line := p.lines[p.i]
+	text := strings.TrimLeft(line, " ")
+	return len(line) - len(text), strings.TrimRight(stripYAMLComment(text), " \t")
+}
+
+func (p *yamlParser) advance() {
+	p.override = nil
+	p.i++
+}
+
+// skipBlank moves past blank and comment lines, returning false if there
+// are no more lines.
+func (p *yamlParser) skipBlank() bool {
+	for p.i < len(p.lines) {
+		if _, text := p.current(); text != "" {
+			return true
+		}
+		p.advance()
+	}
+	return false
+}
+
+// stripYAMLComment removes a trailing comment, which begins with a # at the
+// start of text or following whitespace, outside of any quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" \t[{,:-", text[i-1]) != -1 {
+				quote = c
+			}
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// parseNode parses the block node starting at the current line, which must
+// be indented at least minIndent; a missing node is nil.
+func (p *yamlParser) parseNode(minIndent int) (interface{}, error) {
+	if !p.skipBlank() {
+		return nil, nil
+	}
+	indent, text := p.current()
+	if indent < minIndent {
+		return nil, nil
+	}
+	if isYAMLSequenceItem(text) {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(text); ok {
+		return p.parseMapping(indent)
+	}
+	return p.parseScalarLines(indent-1, text)
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseSequence(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for p.skipBlank() {
+		lineIndent, text := p.current()
+		if lineIndent < indent {
+			break
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		if !isYAMLSequenceItem(text) {
+			break
+		}
+		rest := strings.TrimLeft(text[1:], " ")
+		if rest == "" {
+			p.advance()
+			v, err := p.parseNode(indent + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		itemIndent := indent + len(text) - len(rest)
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLSequenceItem(rest) {
+			p.override = &yamlLine{indent: itemIndent, text: rest}
+			v, err := p.parseNode(itemIndent)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			continue
+		}
+		v, err := p.parseValue(indent, rest)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+func (p *yamlParser) parseMapping(indent int) (interface{}, error) {
+	m := NewFrontMatterMap()
+	for p.skipBlank() {
+		lineIndent, text := p.current()
+		if lineIndent < indent {
+			break
+		}
+		if lineIndent > indent {
+			return nil, p.errorf("bad indentation")
+		}
+		key, rest, ok := splitYAMLKey(text)
+		if !ok {
+			if isYAMLSequenceItem(text) {
+				break
+			}
+			return nil, p.errorf("expected a key")
+		}
+		var v interface{}
+		var err error
+		if rest == "" {
+			p.advance()
+			// A sequence may be a mapping value at the same indentation.
+			if p.skipBlank() {
+				if nextIndent, nextText := p.current(); nextIndent == indent && isYAMLSequenceItem(nextText) {
+					v, err = p.parseSequence(indent)
+				} else {
+					v, err = p.parseNode(indent + 1)
+				}
+			}
+		} else {
+			v, err = p.parseValue(indent, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.Set(key, v)
+	}
+	return m, nil
+}
+
+// parseValue parses the inline value text that appears on the current line
+// after a key or "- ", along with any continuation lines indented more than
+// indent.
+func (p *yamlParser) parseValue(indent int, text string) (interface{}, error) {
+	if text[0] == '|' || text[0] == '>' {
+		return p.parseBlockScalar(indent, text)
+	}
+	if text[0] == '[' || text[0] == '{' {
+		// Flow collections may continue onto following lines.
+		for !balancedYAMLFlow(text) && p.i+1 < len(p.lines) {
+			p.advance()
+			_, more := p.current()
+			text += " " + more
+		}
+		p.advance()
+		v, rest, err := parseYAMLFlow(text)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, p.errorf("unexpected %q", rest)
+		}
+		return v, nil
+	}
+	return p.parseScalarLines(indent, text)
+}
+
+// parseScalarLines parses a plain or quoted scalar starting with text on
+// the current line and continuing on following lines indented more than
+// indent; the lines are folded together with spaces.
+func (p *yamlParser) parseScalarLines(indent int, text string) (interface{}, error) {
+	p.advance()
+	quoted := text[0] == '"' || text[0] == '\''
+	for p.i < len(p.lines) {
+		line := p.lines[p.i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			if quoted && !closedYAMLQuote(text) {
+				text += "\n"
+				p.advance()
+				continue
+			}
+			break
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if lineIndent <= indent {
+			break
+		}
+		if !quoted {
+			trimmed = strings.TrimRight(stripYAMLComment(trimmed), " \t")
+			if trimmed == "" {
+				break
+			}
+			if _, _, ok := splitYAMLKey(trimmed); ok {
+				return nil, p.errorf("unexpected mapping")
+			}
+		} else if closedYAMLQuote(text) {
+			break
+		}
+		if strings.HasSuffix(text, "\n") {
+			text += trimmed
+		} else {
+			text += " " + trimmed
+		}
+		p.advance()
+	}
+	if quoted {
+		v, rest, err := parseYAMLQuoted(text)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		if strings.TrimSpace(stripYAMLComment(rest)) != "" {
+			return nil, p.errorf("unexpected %q", rest)
+		}
+		return v, nil
+	}
+	return resolveYAMLScalar(text), nil
+}
+
+func closedYAMLQuote(text string) bool {
+	_, _, err := parseYAMLQuoted(text)
+	return err == nil
+}
+
+// parseBlockScalar parses a | (literal) or > (folded) block scalar whose
+// header is on the current line.
+func (p *yamlParser) parseBlockScalar(indent int, header string) (interface{}, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	explicit := 0
+	for _, c := range header[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			explicit = int(c - '0')
+		default:
+			return nil, p.errorf("bad block scalar header %q", header)
+		}
+	}
+	p.advance()
+	blockIndent := -1
+	if explicit > 0 {
+		blockIndent = indent + explicit
+	}
+	var lines []string
+	for p.i < len(p.lines) {
+		line := strings.TrimRight(p.lines[p.i], "\r")
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			p.advance()
+			continue
+		}
+		lineIndent := len(line) - len(strings.TrimLeft(line, " "))
+		if blockIndent == -1 {
+			if lineIndent <= indent {
+				break
+			}
+			blockIndent = lineIndent
+		}
+		if lineIndent < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+		p.advance()
+	}
+	// Trailing blank lines only matter for chomping.
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var text string
+	if folded {
+		var b strings.Builder
+		for i, line := range lines {
+			switch {
+			case i == 0:
+			case line == "" || lines[i-1] == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(lines[i-1], " "):
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+			b.WriteString(line)
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+	switch chomp {
+	case '-':
+	case '+':
+		text += "\n" + strings.Repeat("\n", trailing)
+	default:
+		if len(lines) > 0 {
+			text += "\n"
+		}
+	}
+	return text, nil
+}
+
+// splitYAMLKey splits a "key: value" line, returning false if text is not
+// one.
+func splitYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' || text[0] == '#' || isYAMLSequenceItem(text) {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		key, rest, err := parseYAMLQuoted(text)
+		if err != nil || !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ' && rest[1] != '\t') {
+			return "", "", false
+		}
+		return fmt.Sprint(key), strings.TrimSpace(rest[1:]), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ' || text[i+1] == '\t') {
+			key := strings.TrimRight(text[:i], " \t")
+			if key == "" {
+				return "", "", false
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// balancedYAMLFlow returns true if every bracket and brace opened in text
+// outside of quotes has been closed.
+func balancedYAMLFlow(text string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// parseYAMLFlow parses a flow collection or scalar at the start of text,
+// returning the value and the rest of text.
+func parseYAMLFlow(text string) (interface{}, string, error) {
+	text = strings.TrimLeft(text, " \t")
+	if text == "" {
+		return nil, "", nil
+	}
+	switch text[0] {
+	case '[':
+		list := []interface{}{}
+		text = strings.TrimLeft(text[1:], " \t")
+		for {
+			if text == "" {
+				return nil, "", fmt.Errorf("unclosed [")
+			}
+			if text[0] == ']' {
+				return list, text[1:], nil
+			}
+			v, rest, err := parseYAMLFlow(text)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, v)
+			text = strings.TrimLeft(rest, " \t")
+			if strings.HasPrefix(text, ",") {
+				text = strings.TrimLeft(text[1:], " \t")
+			} else if !strings.HasPrefix(text, "]") {
+				return nil, "", fmt.Errorf("expected , or ]")
+			}
+		}
+	case '{':
+		m := NewFrontMatterMap()
+		text = strings.TrimLeft(text[1:], " \t")
+		for {
+			if text == "" {
+				return nil, "", fmt.Errorf("unclosed {")
+			}
+			if text[0] == '}' {
+				return m, text[1:], nil
+			}
+			k, rest, err := parseYAMLFlow(text)
+			if err != nil {
+				return nil, "", err
+			}
+			rest = strings.TrimLeft(rest, " \t")
+			if !strings.HasPrefix(rest, ":") {
+				return nil, "", fmt.Errorf("expected :")
+			}
+			v, rest, err := parseYAMLFlow(rest[1:])
+			if err != nil {
+				return nil, "", err
+			}
+			m.Set(fmt.Sprint(k), v)
+			text = strings.TrimLeft(rest, " \t")
+			if strings.HasPrefix(text, ",") {
+				text = strings.TrimLeft(text[1:], " \t")
+			} else if !strings.HasPrefix(text, "}") {
+				return nil, "", fmt.Errorf("expected , or }")
+			}
+		}
+	case '"', '\'':
+		return parseYAMLQuoted(text)
+	}
+	end := 0
+	for end < len(text) && strings.IndexByte(",]}", text[end]) == -1 &&
+		!(text[end] == ':' && (end+1 == len(text) || text[end+1] == ' ')) {
+		end++
+	}
+	return resolveYAMLScalar(strings.TrimSpace(text[:end])), text[end:], nil
+}
+
+// parseYAMLQuoted parses the quoted string at the start of text, returning
+// it and the rest of text.
+func parseYAMLQuoted(text string) (interface{}, string, error) {
+	quote := text[0]
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		if c == quote {
+			if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return b.String(), text[i+1:], nil
+		}
+		if c != '\\' || quote != '"' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(text) {
+			break
+		}
+		switch text[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case 'x', 'u', 'U':
+			n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[i]]
+			if i+n >= len(text) {
+				return nil, "", fmt.Errorf("bad escape")
+			}
+			r, err := strconv.ParseUint(text[i+1:i+1+n], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				return nil, "", fmt.Errorf("bad escape")
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			b.WriteByte(text[i])
+		}
+	}
+	return nil, "", fmt.Errorf("unclosed %c", quote)
+}
+
+var (
+	yamlIntPattern   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9]*)$`)
+	yamlFloatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolveYAMLScalar returns the typed value of the plain scalar text.
+func resolveYAMLScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if yamlIntPattern.MatchString(text) {
+		if v, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return v
+		}
+	}
+	if yamlFloatPattern.MatchString(text) {
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return v
+		}
+	}
+	return text
+}